@@ -0,0 +1,164 @@
+package shim
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Well-known node labels for failure domains
+const (
+	LabelZone = "zone"
+	LabelRack = "rack"
+	LabelHost = "host"
+)
+
+// NodeInfo ...
+type NodeInfo struct {
+	Name   string
+	Addr   string
+	Weight int
+	Labels map[string]string
+}
+
+// Allocator computes the assignment of partitions to nodes.
+// The nodes are sorted by name and each has a positive weight, current is the partitions
+// each node is known to be running. Every partition in [0, partitionCount) should be assigned to exactly one node
+type Allocator interface {
+	Allocate(partitionCount int, nodes []NodeInfo, current map[string][]PartitionID) map[string][]PartitionID
+}
+
+type stickyAllocator struct {
+}
+
+type rendezvousAllocator struct {
+}
+
+type zoneAwareAllocator struct {
+	label string
+}
+
+// NewStickyAllocator returns the default allocator, it balances partitions by node weights
+// and keeps partitions on the nodes currently running them as much as possible
+func NewStickyAllocator() Allocator {
+	return stickyAllocator{}
+}
+
+// NewRendezvousAllocator returns an allocator using weighted rendezvous (highest random weight) hashing.
+// The result only depends on the list of nodes, so every node computes the same owners without shared history,
+// and a membership change only moves the partitions from or to the changed node
+func NewRendezvousAllocator() Allocator {
+	return rendezvousAllocator{}
+}
+
+// NewZoneAwareAllocator returns a sticky allocator that first balances partitions between the failure domains
+// identified by the node label (e.g. LabelZone), proportionally to the total weight of each domain,
+// then between the nodes inside each domain. Losing a domain only moves the partitions of that domain.
+// Nodes without the label belong to a domain with an empty name
+func NewZoneAwareAllocator(label string) Allocator {
+	return zoneAwareAllocator{label: label}
+}
+
+func (stickyAllocator) Allocate(
+	partitionCount int, nodes []NodeInfo, current map[string][]PartitionID,
+) map[string][]PartitionID {
+	names := make([]string, 0, len(nodes))
+	weights := make([]int, 0, len(nodes))
+	for _, n := range nodes {
+		names = append(names, n.Name)
+		weights = append(weights, n.Weight)
+	}
+	return reallocateWeightedPartitions(partitionCount, names, weights, current)
+}
+
+func (rendezvousAllocator) Allocate(
+	partitionCount int, nodes []NodeInfo, _ map[string][]PartitionID,
+) map[string][]PartitionID {
+	result := map[string][]PartitionID{}
+	for p := 0; p < partitionCount; p++ {
+		bestIndex := 0
+		bestScore := math.Inf(-1)
+		for i, n := range nodes {
+			score := rendezvousScore(n.Name, PartitionID(p), n.Weight)
+			if score > bestScore {
+				bestIndex = i
+				bestScore = score
+			}
+		}
+
+		name := nodes[bestIndex].Name
+		result[name] = append(result[name], PartitionID(p))
+	}
+	return result
+}
+
+func (a zoneAwareAllocator) Allocate(
+	partitionCount int, nodes []NodeInfo, current map[string][]PartitionID,
+) map[string][]PartitionID {
+	var zones []string
+	zoneNodes := map[string][]NodeInfo{}
+	zoneWeights := map[string]int{}
+	zoneCurrent := partitionAssigns{}
+
+	for _, n := range nodes {
+		zone := n.Labels[a.label]
+		if _, existed := zoneNodes[zone]; !existed {
+			zones = append(zones, zone)
+		}
+		zoneNodes[zone] = append(zoneNodes[zone], n)
+		zoneWeights[zone] += n.Weight
+		zoneCurrent[zone] = append(zoneCurrent[zone], current[n.Name]...)
+	}
+	sort.Strings(zones)
+
+	weights := make([]int, 0, len(zones))
+	for _, zone := range zones {
+		weights = append(weights, zoneWeights[zone])
+	}
+	zoneAssigns := reallocateWeightedPartitions(partitionCount, zones, weights, zoneCurrent)
+
+	result := map[string][]PartitionID{}
+	for _, zone := range zones {
+		partitions := append([]PartitionID(nil), zoneAssigns[zone]...)
+		sort.Slice(partitions, func(i, j int) bool {
+			return partitions[i] < partitions[j]
+		})
+
+		var names []string
+		var nodeWeights []int
+		for _, n := range zoneNodes[zone] {
+			names = append(names, n.Name)
+			nodeWeights = append(nodeWeights, n.Weight)
+		}
+
+		for name, assigned := range reallocateWeightedSubset(partitions, names, nodeWeights, current) {
+			result[name] = assigned
+		}
+	}
+	return result
+}
+
+// rendezvousScore computes -weight / ln(h) with h is the hash of the pair (node, partition) mapped to (0, 1)
+func rendezvousScore(node string, partition PartitionID, weight int) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(node))
+
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(partition))
+	_, _ = h.Write(buf[:])
+
+	x := mixHash(h.Sum64())
+	unit := (float64(x>>11) + 0.5) / (1 << 53)
+	return -float64(weight) / math.Log(unit)
+}
+
+// mixHash is the finalizer of splitmix64, it spreads the bits of FNV hashes of similar inputs
+func mixHash(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,231 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStickyAllocator(t *testing.T) {
+	result := NewStickyAllocator().Allocate(5, []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+	}, map[string][]PartitionID{
+		"A": {3},
+	})
+
+	assert.Equal(t, map[string][]PartitionID{
+		"A": {3, 0, 1},
+		"B": {2, 4},
+	}, result)
+}
+
+func rendezvousOwners(count int, nodes []NodeInfo) map[PartitionID]string {
+	result := map[PartitionID]string{}
+	for name, partitions := range NewRendezvousAllocator().Allocate(count, nodes, nil) {
+		for _, p := range partitions {
+			result[p] = name
+		}
+	}
+	return result
+}
+
+func TestRendezvousAllocator_All_Partitions_Assigned(t *testing.T) {
+	owners := rendezvousOwners(64, []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+		{Name: "C", Weight: 1},
+	})
+
+	assert.Equal(t, 64, len(owners))
+
+	counts := map[string]int{}
+	for _, name := range owners {
+		counts[name]++
+	}
+	assert.Equal(t, 3, len(counts))
+}
+
+func TestRendezvousAllocator_Independent_Of_Current(t *testing.T) {
+	nodes := []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+	}
+
+	a := NewRendezvousAllocator()
+	assert.Equal(t,
+		a.Allocate(16, nodes, nil),
+		a.Allocate(16, nodes, map[string][]PartitionID{"A": {0, 1, 2, 3, 4, 5, 6, 7, 8}}),
+	)
+}
+
+func TestRendezvousAllocator_Node_Join__Only_Move_To_New_Node(t *testing.T) {
+	before := rendezvousOwners(256, []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+		{Name: "C", Weight: 1},
+	})
+	after := rendezvousOwners(256, []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+		{Name: "C", Weight: 1},
+		{Name: "D", Weight: 1},
+	})
+
+	moved := 0
+	for p, owner := range after {
+		if owner == before[p] {
+			continue
+		}
+		moved++
+		assert.Equal(t, "D", owner)
+	}
+	assert.Greater(t, moved, 32)
+	assert.Less(t, moved, 96)
+}
+
+func TestRendezvousAllocator_Weighted(t *testing.T) {
+	owners := rendezvousOwners(1024, []NodeInfo{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 3},
+	})
+
+	counts := map[string]int{}
+	for _, name := range owners {
+		counts[name]++
+	}
+	assert.Greater(t, counts["A"], 200)
+	assert.Less(t, counts["A"], 312)
+}
+
+func TestCoreService_With_Rendezvous_Allocator(t *testing.T) {
+	c := newCoreServiceTest(16)
+	c.core.options.allocator = NewRendezvousAllocator()
+
+	nodes := []nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	}
+	c.core.onChange(nodes)
+	c.core.onJoinCompleted()
+
+	expected := rendezvousOwners(16, []NodeInfo{
+		{Name: "node01", Addr: "address01", Weight: 1},
+		{Name: "node02", Addr: "address02", Weight: 1},
+	})
+	for i, p := range c.core.partitions {
+		assert.Equal(t, expected[PartitionID(i)], p.state.owner)
+	}
+}
+
+func zoneNode(name string, zone string) NodeInfo {
+	return NodeInfo{Name: name, Weight: 1, Labels: map[string]string{LabelZone: zone}}
+}
+
+func TestZoneAwareAllocator(t *testing.T) {
+	table := []struct {
+		name     string
+		count    int
+		nodes    []NodeInfo
+		current  map[string][]PartitionID
+		expected map[string][]PartitionID
+	}{
+		{
+			name:  "zones-sorted-by-label",
+			count: 6,
+			nodes: []NodeInfo{
+				zoneNode("A", "zone-2"),
+				zoneNode("B", "zone-1"),
+				zoneNode("C", "zone-2"),
+			},
+			current: nil,
+			expected: map[string][]PartitionID{
+				"A": {2, 3},
+				"B": {0, 1},
+				"C": {4, 5},
+			},
+		},
+		{
+			name:  "zone-weights",
+			count: 6,
+			nodes: []NodeInfo{
+				{Name: "A", Weight: 2, Labels: map[string]string{LabelZone: "zone-1"}},
+				zoneNode("B", "zone-2"),
+			},
+			current: nil,
+			expected: map[string][]PartitionID{
+				"A": {0, 1, 2, 3},
+				"B": {4, 5},
+			},
+		},
+		{
+			name:  "keep-current",
+			count: 6,
+			nodes: []NodeInfo{
+				zoneNode("A", "zone-1"),
+				zoneNode("B", "zone-1"),
+				zoneNode("C", "zone-2"),
+			},
+			current: map[string][]PartitionID{
+				"A": {5},
+				"C": {0, 1, 2, 3},
+			},
+			expected: map[string][]PartitionID{
+				"A": {5, 2},
+				"B": {3, 4},
+				"C": {0, 1},
+			},
+		},
+		{
+			name:  "zone-lost-only-moves-its-partitions",
+			count: 6,
+			nodes: []NodeInfo{
+				zoneNode("A", "zone-1"),
+				zoneNode("C", "zone-2"),
+			},
+			current: map[string][]PartitionID{
+				"A": {0, 1},
+				"C": {2, 3},
+			},
+			expected: map[string][]PartitionID{
+				"A": {0, 1, 4},
+				"C": {2, 3, 5},
+			},
+		},
+		{
+			name:  "nodes-without-label",
+			count: 4,
+			nodes: []NodeInfo{
+				{Name: "A", Weight: 1},
+				zoneNode("B", "zone-1"),
+				{Name: "C", Weight: 1},
+			},
+			current: nil,
+			expected: map[string][]PartitionID{
+				"A": {0, 1},
+				"B": {3},
+				"C": {2},
+			},
+		},
+	}
+
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			result := NewZoneAwareAllocator(LabelZone).Allocate(e.count, e.nodes, e.current)
+			assert.Equal(t, e.expected, result)
+		})
+	}
+}
+
+func TestReallocateWeightedSubset(t *testing.T) {
+	result := reallocateWeightedSubset(
+		[]PartitionID{1, 4, 6, 7}, []string{"A", "B"}, []int{1, 1},
+		partitionAssigns{
+			"A": {0, 6},
+			"B": {4, 1, 7},
+		},
+	)
+	assert.Equal(t, partitionAssigns{
+		"A": {6, 7},
+		"B": {4, 1},
+	}, result)
+}
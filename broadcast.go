@@ -0,0 +1,237 @@
+package shim
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ackedBroadcaster numbers the partition batches sent by this node and retransmits them
+// until every member at the time of sending has acknowledged them or left the cluster.
+// Completed sequence numbers are tracked by a sequenceManager, retransmissions start from its uncompletedFrom.
+// At most windowSize broadcasts are pending, older ones are given up even if a member never acknowledges them
+type ackedBroadcaster struct {
+	mut sync.Mutex
+
+	selfNode string
+	send     func(msg []byte)
+	clock    Clock
+	interval time.Duration
+
+	nextSeq     uint64
+	windowSize  int
+	seqs        *sequenceManager
+	pending     map[uint64]*pendingBroadcast
+	members     map[string]struct{}
+	timer       Timer
+	armed       bool
+	stopped     bool
+	retransmits uint64
+	overflows   uint64
+}
+
+type pendingBroadcast struct {
+	data    []byte
+	waiting map[string]struct{}
+}
+
+// initialAckWindowSize is the initial size of the window of sequence numbers, it grows up to the window size option
+const initialAckWindowSize = 64
+
+func newAckedBroadcaster(
+	selfNode string, send func(msg []byte),
+	clock Clock, interval time.Duration, windowSize int,
+) *ackedBroadcaster {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	initialSize := initialAckWindowSize
+	if initialSize > windowSize {
+		initialSize = windowSize
+	}
+
+	return &ackedBroadcaster{
+		selfNode: selfNode,
+		send:     send,
+		clock:    clock,
+		interval: interval,
+
+		nextSeq:    1,
+		windowSize: windowSize,
+		seqs:       newGrowingSequenceManager(initialSize, windowSize),
+		pending:    map[uint64]*pendingBroadcast{},
+		members:    map[string]struct{}{},
+	}
+}
+
+// broadcast sends a marshaled partition batch, it is not retransmitted when there is no other member
+func (b *ackedBroadcaster) broadcast(batch []byte) {
+	b.mut.Lock()
+	seq := b.nextSeq
+	b.nextSeq++
+	data := marshalSequencedPartitions(b.selfNode, seq, batch)
+
+	if len(b.members) == 0 || b.stopped {
+		b.seqs.setCompleted(seq)
+		b.mut.Unlock()
+
+		b.send(data)
+		return
+	}
+
+	waiting := make(map[string]struct{}, len(b.members))
+	for name := range b.members {
+		waiting[name] = struct{}{}
+	}
+	b.pending[seq] = &pendingBroadcast{data: data, waiting: waiting}
+	b.dropOverflowed(seq)
+	b.startTimer()
+	b.mut.Unlock()
+
+	b.send(data)
+}
+
+// startTimer arms the retransmission when it is not pending already,
+// so that frequent broadcasts do not postpone it
+func (b *ackedBroadcaster) startTimer() {
+	if b.armed {
+		return
+	}
+	b.armed = true
+
+	if b.timer == nil {
+		b.timer = b.clock.NewTimer(b.interval, b.retransmit)
+		return
+	}
+	b.timer.Reset()
+}
+
+func (b *ackedBroadcaster) retransmit() {
+	b.mut.Lock()
+	b.armed = false
+	if b.stopped {
+		b.mut.Unlock()
+		return
+	}
+
+	var msgs [][]byte
+	for seq := b.seqs.uncompletedFrom(); seq < b.nextSeq; seq++ {
+		p, ok := b.pending[seq]
+		if !ok {
+			continue
+		}
+		msgs = append(msgs, p.data)
+	}
+	b.retransmits += uint64(len(msgs))
+	if len(b.pending) > 0 {
+		b.startTimer()
+	}
+	b.mut.Unlock()
+
+	for _, data := range msgs {
+		b.send(data)
+	}
+}
+
+func (b *ackedBroadcaster) recvAck(ack partitionsAck) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if ack.to != b.selfNode {
+		return
+	}
+	for _, seq := range ack.seqs {
+		p, ok := b.pending[seq]
+		if !ok {
+			continue
+		}
+		delete(p.waiting, ack.from)
+		if len(p.waiting) == 0 {
+			b.complete(seq)
+		}
+	}
+}
+
+// complete also drops the broadcasts left behind by the window of the sequence manager
+func (b *ackedBroadcaster) complete(seq uint64) {
+	delete(b.pending, seq)
+	b.seqs.setCompleted(seq)
+
+	from := b.seqs.uncompletedFrom()
+	for pendingSeq := range b.pending {
+		if pendingSeq < from {
+			delete(b.pending, pendingSeq)
+		}
+	}
+}
+
+// dropOverflowed gives up the pending broadcasts falling out of the window ending at seq,
+// they are considered completed so that the sequence manager does not count them again
+func (b *ackedBroadcaster) dropOverflowed(seq uint64) {
+	if seq < uint64(b.windowSize) {
+		return
+	}
+	oldest := seq - uint64(b.windowSize) + 1
+
+	for dropped := b.seqs.uncompletedFrom(); dropped < oldest; dropped++ {
+		if _, ok := b.pending[dropped]; ok {
+			delete(b.pending, dropped)
+			b.overflows++
+		}
+		b.seqs.setCompleted(dropped)
+	}
+}
+
+func (b *ackedBroadcaster) memberJoined(name string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if name == b.selfNode {
+		return
+	}
+	b.members[name] = struct{}{}
+}
+
+// memberLeft stops waiting for the acknowledgements of the member
+func (b *ackedBroadcaster) memberLeft(name string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	delete(b.members, name)
+
+	seqs := make([]uint64, 0, len(b.pending))
+	for seq := range b.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+
+	for _, seq := range seqs {
+		p := b.pending[seq]
+		delete(p.waiting, name)
+		if len(p.waiting) == 0 {
+			b.complete(seq)
+		}
+	}
+}
+
+func (b *ackedBroadcaster) stop() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	b.stopped = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// addStats sets the counters of the broadcaster, overflows are the broadcasts no longer retransmitted
+// because too many newer broadcasts were sent before they were acknowledged
+func (b *ackedBroadcaster) addStats(stats *Stats) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	stats.Retransmits = b.retransmits
+	stats.BroadcastOverflows = b.overflows + b.seqs.overflowCount()
+}
@@ -0,0 +1,184 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type ackedBroadcasterTest struct {
+	clock *fakeClock
+	b     *ackedBroadcaster
+	sent  []sequencedPartitions
+}
+
+func newAckedBroadcasterTest() *ackedBroadcasterTest {
+	c := &ackedBroadcasterTest{clock: newFakeClock()}
+	c.b = newAckedBroadcaster("node01", func(data []byte) {
+		var msg sequencedPartitions
+		if err := msg.Unmarshal(data); err != nil {
+			panic(err)
+		}
+		c.sent = append(c.sent, msg)
+	}, c.clock, time.Second, 4)
+	return c
+}
+
+func (c *ackedBroadcasterTest) sentSeqs() []uint64 {
+	var result []uint64
+	for _, msg := range c.sent {
+		result = append(result, msg.seq)
+	}
+	return result
+}
+
+func testBatch(id PartitionID) []byte {
+	return partitionBatch{{id: id, msg: partitionMsg{incarnation: 1, current: "node01"}}}.Marshal()
+}
+
+func TestAckedBroadcaster_No_Members__Not_Retransmit(t *testing.T) {
+	c := newAckedBroadcasterTest()
+
+	c.b.broadcast(testBatch(1))
+	c.clock.advance(time.Hour)
+
+	assert.Equal(t, []uint64{1}, c.sentSeqs())
+	assert.Equal(t, sequencedPartitions{
+		sender: "node01",
+		seq:    1,
+		batch:  partitionBatch{{id: 1, msg: partitionMsg{incarnation: 1, current: "node01"}}},
+	}, c.sent[0])
+	assert.Equal(t, uint64(2), c.b.seqs.uncompletedFrom())
+}
+
+func TestAckedBroadcaster_Retransmit_Until_All_Acked(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+	c.b.memberJoined("node03")
+
+	c.b.broadcast(testBatch(1))
+	c.b.broadcast(testBatch(2))
+	assert.Equal(t, []uint64{1, 2}, c.sentSeqs())
+
+	c.b.recvAck(partitionsAck{from: "node02", to: "node01", seqs: []uint64{1, 2}})
+	c.b.recvAck(partitionsAck{from: "node03", to: "node01", seqs: []uint64{2}})
+	// acks to other nodes are ignored
+	c.b.recvAck(partitionsAck{from: "node03", to: "node02", seqs: []uint64{1}})
+	assert.Equal(t, uint64(1), c.b.seqs.uncompletedFrom())
+
+	c.clock.advance(time.Second)
+	assert.Equal(t, []uint64{1, 2, 1}, c.sentSeqs())
+	assert.Equal(t, uint64(1), c.b.retransmits)
+
+	c.b.recvAck(partitionsAck{from: "node03", to: "node01", seqs: []uint64{1}})
+	assert.Equal(t, uint64(3), c.b.seqs.uncompletedFrom())
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, []uint64{1, 2, 1}, c.sentSeqs())
+}
+
+func TestAckedBroadcaster_Member_Left__Stop_Waiting(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+	c.b.memberJoined("node03")
+
+	c.b.broadcast(testBatch(1))
+	c.b.recvAck(partitionsAck{from: "node02", to: "node01", seqs: []uint64{1}})
+
+	c.b.memberLeft("node03")
+	assert.Equal(t, uint64(2), c.b.seqs.uncompletedFrom())
+	assert.Equal(t, 0, len(c.b.pending))
+
+	// a member joined after the broadcast is not waited for
+	c.b.memberJoined("node04")
+	c.clock.advance(time.Hour)
+	assert.Equal(t, []uint64{1}, c.sentSeqs())
+}
+
+func TestAckedBroadcaster_Stopped__Not_Retransmit(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+
+	c.b.broadcast(testBatch(1))
+	c.b.stop()
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, []uint64{1}, c.sentSeqs())
+}
+
+func TestService_Sequenced_Partitions__Acked(t *testing.T) {
+	delegate := &NodeDelegateMock{
+		BroadcastFunc: func(msg []byte) {},
+	}
+	s := New(4, "node02", "address02", &PartitionRunnerMock{}, WithNodeDelegate(delegate))
+
+	s.NotifyMsg(marshalSequencedPartitions("node01", 5, partitionBatch{
+		{id: 2, msg: partitionMsg{incarnation: 3, current: "node01"}},
+	}.Marshal()))
+
+	assert.Equal(t, partitionState{
+		incarnation: 3,
+		current:     "node01",
+	}, s.core.partitions[2].state)
+
+	assert.Equal(t, 1, len(delegate.BroadcastCalls()))
+	var ack partitionsAck
+	assert.Equal(t, nil, ack.Unmarshal(delegate.BroadcastCalls()[0].Msg))
+	assert.Equal(t, partitionsAck{from: "node02", to: "node01", seqs: []uint64{5}}, ack)
+}
+
+func TestAckedBroadcaster_Window_Exceeded__Overflow(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+
+	for i := 0; i < 6; i++ {
+		c.b.broadcast(testBatch(PartitionID(i)))
+	}
+	c.b.recvAck(partitionsAck{from: "node02", to: "node01", seqs: []uint64{6}})
+
+	var stats Stats
+	c.b.addStats(&stats)
+	assert.Equal(t, uint64(2), stats.BroadcastOverflows)
+	assert.Equal(t, uint64(3), c.b.seqs.uncompletedFrom())
+
+	c.clock.advance(time.Second)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 3, 4, 5}, c.sentSeqs())
+}
+
+func TestAckedBroadcaster_Member_Never_Acks__Pending_Bounded_By_Window(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+
+	for i := 0; i < 100; i++ {
+		c.b.broadcast(testBatch(PartitionID(i)))
+	}
+
+	assert.Equal(t, 4, len(c.b.pending))
+	assert.Equal(t, uint64(97), c.b.seqs.uncompletedFrom())
+
+	var stats Stats
+	c.b.addStats(&stats)
+	assert.Equal(t, uint64(96), stats.BroadcastOverflows)
+
+	c.sent = nil
+	c.clock.advance(time.Second)
+	assert.Equal(t, []uint64{97, 98, 99, 100}, c.sentSeqs())
+}
+
+func TestAckedBroadcaster_Frequent_Broadcasts__Still_Retransmit(t *testing.T) {
+	c := newAckedBroadcasterTest()
+	c.b.memberJoined("node02")
+
+	c.b.broadcast(testBatch(1))
+	for i := 0; i < 3; i++ {
+		c.clock.advance(400 * time.Millisecond)
+		c.b.broadcast(testBatch(PartitionID(i + 2)))
+		c.b.recvAck(partitionsAck{from: "node02", to: "node01", seqs: []uint64{uint64(i + 2)}})
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3, 1, 4}, c.sentSeqs())
+	assert.Equal(t, uint64(1), c.b.retransmits)
+
+	c.clock.advance(time.Second)
+	assert.Equal(t, []uint64{1, 2, 3, 1, 4, 1}, c.sentSeqs())
+}
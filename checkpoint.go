@@ -0,0 +1,214 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const checkpointVersion uint8 = 1
+
+// ErrStaleCheckpoint is returned by Save of the checkpoint stores of this package
+// when the stored checkpoint was written by a newer epoch
+var ErrStaleCheckpoint = errors.New("shim: checkpoint is older than the stored one")
+
+// Checkpoint is the position a partition was processed up to, Epoch is the epoch of its writer
+type Checkpoint struct {
+	Watermark uint64
+	Epoch     Epoch
+}
+
+// CheckpointStore stores the last checkpoint of each partition, it must be reachable from all nodes
+// for a partition to resume where its previous holder left off on another node.
+// Save must reject a checkpoint older than the stored one atomically across all nodes
+type CheckpointStore interface {
+	// Load returns the zero checkpoint when the partition has no checkpoint
+	Load(ctx context.Context, partition PartitionID) (Checkpoint, error)
+	Save(ctx context.Context, partition PartitionID, checkpoint Checkpoint) error
+}
+
+// CheckpointRunner is a PartitionRunnerV2 whose position is saved to the checkpoint store after each successful Stop.
+// When Checkpoint or saving fails, the stop is considered failed and is retried, so Stop must accept being called again.
+// A save rejected with ErrStaleCheckpoint completes the stop, the run has been fenced by a newer holder
+type CheckpointRunner interface {
+	PartitionRunnerV2
+	Checkpoint(ctx context.Context, info PartitionInfo) (watermark uint64, err error)
+}
+
+// loadCheckpoint sets the checkpoint of info before it is passed to Start
+func loadCheckpoint(ctx context.Context, store CheckpointStore, info *PartitionInfo) error {
+	if store == nil {
+		return nil
+	}
+	checkpoint, err := store.Load(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	info.Checkpoint = checkpoint
+	return nil
+}
+
+func saveCheckpoint(ctx context.Context, store CheckpointStore, runner PartitionRunnerV2, info PartitionInfo) error {
+	if store == nil {
+		return nil
+	}
+	checkpointRunner, ok := runner.(CheckpointRunner)
+	if !ok {
+		return nil
+	}
+
+	watermark, err := checkpointRunner.Checkpoint(ctx, info)
+	if err != nil {
+		return err
+	}
+	return store.Save(ctx, info.ID, Checkpoint{Watermark: watermark, Epoch: info.Epoch})
+}
+
+// MemoryCheckpointStore keeps the checkpoints in memory, e.g. for tests or nodes in a single process
+type MemoryCheckpointStore struct {
+	mut         sync.Mutex
+	checkpoints map[PartitionID]Checkpoint
+}
+
+var _ CheckpointStore = &MemoryCheckpointStore{}
+
+// NewMemoryCheckpointStore ...
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		checkpoints: map[PartitionID]Checkpoint{},
+	}
+}
+
+// Load implements CheckpointStore
+func (s *MemoryCheckpointStore) Load(_ context.Context, partition PartitionID) (Checkpoint, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.checkpoints[partition], nil
+}
+
+// Save implements CheckpointStore, it returns ErrStaleCheckpoint when the stored checkpoint has a newer epoch
+func (s *MemoryCheckpointStore) Save(_ context.Context, partition PartitionID, checkpoint Checkpoint) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if checkpoint.Epoch.Less(s.checkpoints[partition].Epoch) {
+		return ErrStaleCheckpoint
+	}
+	s.checkpoints[partition] = checkpoint
+	return nil
+}
+
+// FileCheckpointStore keeps each checkpoint in a file of a directory. It is for a single process only,
+// e.g. nodes of a simulation or a single node restarting: saves are fenced by epoch under a lock of the process,
+// so stores of several processes sharing the directory may overwrite a checkpoint with an older epoch.
+// Nodes in separate processes need a store whose Save compares the epochs atomically, e.g. a database transaction
+type FileCheckpointStore struct {
+	mut sync.Mutex
+	dir string
+}
+
+var _ CheckpointStore = &FileCheckpointStore{}
+
+// NewFileCheckpointStore creates the store, the directory is created when it does not exist
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{dir: dir}, nil
+}
+
+func (s *FileCheckpointStore) path(partition PartitionID) string {
+	return filepath.Join(s.dir, strconv.FormatUint(uint64(partition), 10)+".checkpoint")
+}
+
+// Load implements CheckpointStore
+func (s *FileCheckpointStore) Load(_ context.Context, partition PartitionID) (Checkpoint, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.load(partition)
+}
+
+func (s *FileCheckpointStore) load(partition PartitionID) (Checkpoint, error) {
+	data, err := os.ReadFile(s.path(partition))
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	checkpoint, err := unmarshalCheckpoint(data)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("shim: checkpoint of partition %d: %w", partition, err)
+	}
+	return checkpoint, nil
+}
+
+// Save implements CheckpointStore, the file is replaced atomically.
+// It returns ErrStaleCheckpoint when the stored checkpoint has a newer epoch
+func (s *FileCheckpointStore) Save(_ context.Context, partition PartitionID, checkpoint Checkpoint) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	prev, err := s.load(partition)
+	if err != nil {
+		return err
+	}
+	if checkpoint.Epoch.Less(prev.Epoch) {
+		return ErrStaleCheckpoint
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(marshalCheckpoint(checkpoint)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(partition))
+}
+
+func marshalCheckpoint(checkpoint Checkpoint) []byte {
+	data := []byte{checkpointVersion}
+	data = appendUvarint(data, checkpoint.Watermark)
+	data = appendUvarint(data, checkpoint.Epoch.Incarnation)
+	return appendString(data, checkpoint.Epoch.Node)
+}
+
+func unmarshalCheckpoint(data []byte) (Checkpoint, error) {
+	if len(data) < 1 {
+		return Checkpoint{}, errInvalidMessage
+	}
+	if data[0] != checkpointVersion {
+		return Checkpoint{}, errUnsupportedVersion
+	}
+
+	d := &messageDecoder{data: data[1:]}
+	watermark := d.uvarint()
+	incarnation := d.uvarint()
+	node := d.string()
+	if err := d.finish(); err != nil {
+		return Checkpoint{}, err
+	}
+
+	return Checkpoint{
+		Watermark: watermark,
+		Epoch:     Epoch{Incarnation: incarnation, Node: node},
+	}, nil
+}
@@ -0,0 +1,193 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryCheckpointStore()
+
+	checkpoint, err := s.Load(ctx, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Checkpoint{}, checkpoint)
+
+	newer := Checkpoint{Watermark: 30, Epoch: Epoch{Incarnation: 3, Node: "node01"}}
+	assert.Equal(t, nil, s.Save(ctx, 2, newer))
+
+	older := Checkpoint{Watermark: 40, Epoch: Epoch{Incarnation: 2, Node: "node02"}}
+	assert.Equal(t, ErrStaleCheckpoint, s.Save(ctx, 2, older))
+
+	checkpoint, err = s.Load(ctx, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, newer, checkpoint)
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+
+	s, err := NewFileCheckpointStore(dir)
+	assert.Equal(t, nil, err)
+
+	checkpoint, err := s.Load(ctx, 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Checkpoint{}, checkpoint)
+
+	first := Checkpoint{Watermark: 300, Epoch: Epoch{Incarnation: 1, Node: "node01"}}
+	second := Checkpoint{Watermark: 500, Epoch: Epoch{Incarnation: 2, Node: "node02"}}
+	assert.Equal(t, nil, s.Save(ctx, 5, first))
+	assert.Equal(t, nil, s.Save(ctx, 5, second))
+	assert.Equal(t, ErrStaleCheckpoint, s.Save(ctx, 5, first))
+
+	// read by another store of the same directory
+	other, err := NewFileCheckpointStore(dir)
+	assert.Equal(t, nil, err)
+	checkpoint, err = other.Load(ctx, 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, second, checkpoint)
+
+	entries, err := os.ReadDir(dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(entries))
+
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "6.checkpoint"), []byte{checkpointVersion, 1}, 0o644))
+	_, err = s.Load(ctx, 6)
+	assert.Equal(t, true, errors.Is(err, errInvalidMessage))
+}
+
+type testCheckpointRunner struct {
+	mut        sync.Mutex
+	started    chan PartitionInfo
+	watermarks map[PartitionID]uint64
+}
+
+func newTestCheckpointRunner() *testCheckpointRunner {
+	return &testCheckpointRunner{
+		started:    make(chan PartitionInfo, 16),
+		watermarks: map[PartitionID]uint64{},
+	}
+}
+
+func (r *testCheckpointRunner) Start(_ context.Context, info PartitionInfo) error {
+	r.mut.Lock()
+	r.watermarks[info.ID] = info.Checkpoint.Watermark
+	r.mut.Unlock()
+
+	r.started <- info
+	return nil
+}
+
+func (r *testCheckpointRunner) Stop(context.Context, PartitionInfo) error {
+	return nil
+}
+
+func (r *testCheckpointRunner) Checkpoint(_ context.Context, info PartitionInfo) (uint64, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.watermarks[info.ID], nil
+}
+
+func (r *testCheckpointRunner) process(id PartitionID, count uint64) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.watermarks[id] += count
+}
+
+func TestServiceV2_Checkpoint__Resume_On_Next_Holder(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+
+	runner1 := newTestCheckpointRunner()
+	s1 := NewV2(1, "node01", "address01", runner1, WithCheckpointStore(store))
+	s1.Start()
+
+	info := <-runner1.started
+	assert.Equal(t, PartitionInfo{ID: 0, Epoch: Epoch{Incarnation: 1, Node: "node01"}}, info)
+
+	runner1.process(0, 42)
+	shutdownService(t, s1)
+
+	checkpoint, err := store.Load(context.Background(), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Checkpoint{Watermark: 42, Epoch: Epoch{Incarnation: 1, Node: "node01"}}, checkpoint)
+
+	runner2 := newTestCheckpointRunner()
+	s2 := NewV2(1, "node02", "address02", runner2, WithCheckpointStore(store))
+	s2.MergeRemoteState(s1.LocalState())
+	s2.Start()
+	defer shutdownService(t, s2)
+
+	select {
+	case info := <-runner2.started:
+		assert.Equal(t, PartitionInfo{
+			ID:         0,
+			Epoch:      Epoch{Incarnation: 2, Node: "node02"},
+			Checkpoint: checkpoint,
+		}, info)
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition not started")
+	}
+}
+
+type failingCheckpointStore struct {
+	CheckpointStore
+	mut      sync.Mutex
+	failures int
+}
+
+func (s *failingCheckpointStore) Load(ctx context.Context, partition PartitionID) (Checkpoint, error) {
+	s.mut.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mut.Unlock()
+		return Checkpoint{}, errors.New("load failed")
+	}
+	s.mut.Unlock()
+	return s.CheckpointStore.Load(ctx, partition)
+}
+
+func TestServiceV2_Checkpoint_Load_Failed__Start_Retried(t *testing.T) {
+	store := &failingCheckpointStore{CheckpointStore: NewMemoryCheckpointStore(), failures: 2}
+
+	runner := newTestCheckpointRunner()
+	s := NewV2(1, "node01", "address01", runner,
+		WithCheckpointStore(store),
+		WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+	)
+	s.Start()
+	defer shutdownService(t, s)
+
+	select {
+	case <-runner.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition not started")
+	}
+	assert.Equal(t, 0, store.failures)
+}
+
+func TestServiceV2_Checkpoint_Stale__Stop_Completed(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+
+	runner := newTestCheckpointRunner()
+	s := NewV2(1, "node01", "address01", runner, WithCheckpointStore(store))
+	s.Start()
+	<-runner.started
+
+	// node02 took the partition over after a forced handoff
+	newer := Checkpoint{Watermark: 100, Epoch: Epoch{Incarnation: 2, Node: "node02"}}
+	assert.Equal(t, nil, store.Save(context.Background(), 0, newer))
+
+	runner.process(0, 42)
+	shutdownService(t, s)
+
+	checkpoint, err := store.Load(context.Background(), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, newer, checkpoint)
+}
@@ -1,6 +1,7 @@
 package shim
 
 import (
+	"context"
 	"sync"
 )
 
@@ -10,19 +11,586 @@ type coreService struct {
 	partitionCount int
 	options        serviceOptions
 	selfNode       string
-	runner         PartitionRunner
+	runner         coreRunner
+	replicaRunner  ReplicaRunner
+	broadcaster    partitionBroadcaster
+	events         *eventDispatcher
+
+	joinCompleted bool
+	nodes         []nodeInfo
+
+	shuttingDown bool
+	onDrained    func()
+	closed       bool
 
 	partitions []partition
+	replicas   []replica
+	standbys   [][]string
+
+	cancels     []context.CancelFunc
+	retryTimers []Timer
+
+	opSeqs   []uint64
+	opTimers []Timer
+	stats    Stats
+
+	abandoned      [][]abandonedStart
+	abandonedStops int
+
+	handoffs []handoffWait
+
+	settleTimer  Timer
+	pendingNodes []nodeInfo
+	reserved     map[string]*reservation
+
+	pending  []func()
+	outgoing []partitionEntry
+}
+
+type partitionBroadcaster interface {
+	broadcastPartitions(entries []partitionEntry)
 }
 
+type corePartitionDelegate struct {
+	core *coreService
+	id   PartitionID
+}
+
+type coreReplicaDelegate struct {
+	core *coreService
+	id   PartitionID
+}
+
+var _ nodeListener = &coreService{}
+var _ partitionDelegate = &corePartitionDelegate{}
+var _ replicaDelegate = &coreReplicaDelegate{}
+
 func newCoreService(
-	partitionCount int, selfNode string,
-	runner PartitionRunner, opts serviceOptions,
+	partitionCount int, selfNode string, selfAddr string,
+	runner coreRunner, broadcaster partitionBroadcaster,
+	events *eventDispatcher, opts serviceOptions,
 ) *coreService {
-	return &coreService{
+	s := &coreService{
 		partitionCount: partitionCount,
 		options:        opts,
 		selfNode:       selfNode,
 		runner:         runner,
+		broadcaster:    broadcaster,
+		events:         events,
+
+		nodes: []nodeInfo{{name: selfNode, addr: selfAddr, meta: opts.nodeMeta()}},
+	}
+
+	s.partitions = make([]partition, partitionCount)
+	for i := range s.partitions {
+		s.partitions[i] = newPartition(selfNode, &corePartitionDelegate{
+			core: s,
+			id:   PartitionID(i),
+		})
+	}
+
+	if opts.standbyCount > 0 {
+		s.replicaRunner = runner.replicaRunner()
+	}
+	s.cancels = make([]context.CancelFunc, partitionCount)
+	s.retryTimers = make([]Timer, partitionCount)
+	s.opSeqs = make([]uint64, partitionCount)
+	s.opTimers = make([]Timer, partitionCount)
+	s.abandoned = make([][]abandonedStart, partitionCount)
+	s.handoffs = make([]handoffWait, partitionCount)
+	s.reserved = map[string]*reservation{}
+
+	s.replicas = make([]replica, partitionCount)
+	s.standbys = make([][]string, partitionCount)
+	for i := range s.replicas {
+		s.replicas[i] = newReplica(&coreReplicaDelegate{
+			core: s,
+			id:   PartitionID(i),
+		})
+	}
+	return s
+}
+
+func (s *coreService) lock() {
+	s.mut.Lock()
+}
+
+// unlock releases the mutex and then runs the calls collected while holding it,
+// so that runners and broadcasters are free to call back into the core service.
+// Partition messages produced while holding the mutex are broadcast together as a batch
+func (s *coreService) unlock() {
+	if s.onDrained != nil && s.drained() {
+		s.addPending(s.onDrained)
+		s.onDrained = nil
+	}
+
+	calls := s.pending
+	entries := s.outgoing
+	s.pending = nil
+	s.outgoing = nil
+	s.mut.Unlock()
+
+	if len(entries) > 0 {
+		s.broadcaster.broadcastPartitions(entries)
+	}
+	for _, call := range calls {
+		call()
+	}
+}
+
+func (s *coreService) addPending(call func()) {
+	s.pending = append(s.pending, call)
+}
+
+func (s *coreService) onChange(nodes []nodeInfo) {
+	s.lock()
+	defer s.unlock()
+
+	if s.options.settleDelay > 0 {
+		s.delayNodes(nodes)
+		return
+	}
+	s.applyNodes(nodes)
+}
+
+func (s *coreService) applyNodes(nodes []nodeInfo) {
+	nodeSet := map[string]struct{}{}
+	for _, n := range nodes {
+		nodeSet[n.name] = struct{}{}
+		s.unreserve(n.name)
 	}
+
+	for _, n := range s.nodes {
+		_, existed := nodeSet[n.name]
+		if existed {
+			continue
+		}
+		if s.options.reservationPeriod > 0 && !n.leaving {
+			s.reserve(n.name)
+			continue
+		}
+		s.nodeLeave(n.name)
+	}
+
+	s.nodes = nodes
+	s.reallocate()
+}
+
+func (s *coreService) nodeLeave(name string) {
+	for i := range s.partitions {
+		s.observe(PartitionID(i), func(p *partition) {
+			p.nodeLeave(name)
+		})
+	}
+}
+
+func (s *coreService) onJoinCompleted() {
+	s.lock()
+	defer s.unlock()
+
+	s.joinCompleted = true
+	s.reallocate()
+}
+
+func (s *coreService) reallocate() {
+	if !s.joinCompleted {
+		return
+	}
+
+	nodes := make([]NodeInfo, 0, len(s.nodes))
+	nodeSet := map[string]struct{}{}
+	for _, n := range s.nodes {
+		if n.leaving {
+			continue
+		}
+		nodes = append(nodes, NodeInfo{
+			Name:   n.name,
+			Addr:   n.addr,
+			Weight: n.meta.getWeight(),
+			Labels: n.meta.labels,
+		})
+		nodeSet[n.name] = struct{}{}
+	}
+
+	current := map[string][]PartitionID{}
+	for i, p := range s.partitions {
+		holder := p.state.holder()
+		if p.state.status == partitionStatusStarting {
+			holder = s.selfNode
+		}
+		_, existed := nodeSet[holder]
+		if !existed {
+			continue
+		}
+		current[holder] = append(current[holder], PartitionID(i))
+	}
+
+	targets := s.unhealthyTargets(current, nodes)
+
+	// partitions without a holder prefer their first alive standby, after the partitions really held
+	for i, p := range s.partitions {
+		if p.state.holder() != "" || p.state.status == partitionStatusStarting || p.state.unhealthy {
+			continue
+		}
+		for _, standby := range s.standbys[i] {
+			if _, existed := nodeSet[standby]; existed {
+				current[standby] = append(current[standby], PartitionID(i))
+				break
+			}
+		}
+	}
+
+	owners := make([]string, s.partitionCount)
+	assigns := s.options.allocator.Allocate(s.partitionCount, nodes, current)
+	for _, n := range nodes {
+		for _, id := range assigns[n.Name] {
+			if int(id) >= s.partitionCount {
+				continue
+			}
+			owners[id] = n.Name
+		}
+	}
+	s.limitMigrations(owners, nodeSet)
+	s.keepReserved(owners)
+	s.keepUnhealthyTargets(owners, targets)
+	s.recoverUnhealthy(owners)
+
+	for i, owner := range owners {
+		if s.replicaRunner != nil && owner != "" {
+			s.standbys[i] = computeStandbys(PartitionID(i), owner, nodes, s.options.standbyCount)
+		}
+		s.observe(PartitionID(i), func(p *partition) {
+			p.updateOwner(owner)
+		})
+		s.updateStandby(PartitionID(i))
+	}
+}
+
+// updateStandby runs a standby of the partition on this node only when this node is one of its standbys
+// and is not running the partition itself
+func (s *coreService) updateStandby(id PartitionID) {
+	if s.replicaRunner == nil {
+		return
+	}
+
+	p := &s.partitions[id]
+	wanted := false
+	if !s.shuttingDown && p.state.owner != s.selfNode && p.state.status == partitionStatusStopped {
+		for _, standby := range s.standbys[id] {
+			if standby == s.selfNode {
+				wanted = true
+			}
+		}
+	}
+	s.replicas[id].setWanted(wanted)
+}
+
+func (s *coreService) recvPartitionMsgs(entries []partitionEntry) {
+	s.lock()
+	defer s.unlock()
+
+	holderChanged := false
+	for _, e := range entries {
+		if int(e.id) >= s.partitionCount {
+			continue
+		}
+
+		p := &s.partitions[e.id]
+		prevHolder := p.state.holder()
+		prevUnhealthy := p.state.unhealthy
+		s.observe(e.id, func(p *partition) {
+			p.recvBroadcast(e.msg)
+		})
+		if p.state.holder() != prevHolder || p.state.unhealthy != prevUnhealthy {
+			holderChanged = true
+		}
+	}
+
+	if holderChanged {
+		s.reallocate()
+	}
+}
+
+func (s *coreService) snapshot() []partitionEntry {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var entries []partitionEntry
+	for i, p := range s.partitions {
+		if p.state.current == "" {
+			continue
+		}
+		entries = append(entries, partitionEntry{
+			id:  PartitionID(i),
+			msg: p.getPartitionMsg(),
+		})
+	}
+	return entries
+}
+
+// shutdown stops all partitions and standbys of this node, onDrained is called once all of them are stopped
+// and their messages have been handed to the broadcaster
+func (s *coreService) shutdown(onDrained func()) {
+	s.lock()
+	defer s.unlock()
+
+	s.shuttingDown = true
+	s.onDrained = onDrained
+	s.stopRetryTimers()
+	for i := range s.partitions {
+		s.observe(PartitionID(i), func(p *partition) {
+			p.shutdown()
+			// a stop waiting for its backoff is retried at once instead
+			p.retry()
+		})
+		s.updateStandby(PartitionID(i))
+	}
+}
+
+// close stops the timers of the core service after the node has left the cluster
+func (s *coreService) close() {
+	s.lock()
+	defer s.unlock()
+
+	s.closed = true
+	s.stopRetryTimers()
+}
+
+func (s *coreService) stopRetryTimers() {
+	for i, timer := range s.retryTimers {
+		if timer != nil {
+			timer.Stop()
+			s.retryTimers[i] = nil
+		}
+	}
+}
+
+// notStopped returns the partitions of this node that are not stopped
+func (s *coreService) notStopped() []PartitionID {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var ids []PartitionID
+	for i := range s.partitions {
+		if s.partitions[i].state.status != partitionStatusStopped {
+			ids = append(ids, PartitionID(i))
+		}
+	}
+	return ids
+}
+
+func (s *coreService) drained() bool {
+	if s.abandonedStops > 0 {
+		return false
+	}
+	for i := range s.partitions {
+		if s.partitions[i].state.status != partitionStatusStopped {
+			return false
+		}
+		if s.replicas[i].status != replicaStatusStopped {
+			return false
+		}
+	}
+	return true
+}
+
+// observe runs fn on the partition and publishes the changes of its owner and its holder
+func (s *coreService) observe(id PartitionID, fn func(p *partition)) {
+	p := &s.partitions[id]
+	prev := p.state
+
+	fn(p)
+
+	if p.state.owner != prev.owner && p.state.owner != "" {
+		s.events.publish(Event{Type: EventOwnerAssigned, Partition: id, Node: p.state.owner})
+	}
+
+	holder := p.state.holder()
+	if holder == prev.holder() {
+		return
+	}
+	if holder == "" {
+		s.events.publish(Event{Type: EventStopped, Partition: id, Node: prev.current, Epoch: prev.epoch()})
+		return
+	}
+	s.events.publish(Event{Type: EventStarted, Partition: id, Node: holder, Epoch: p.state.epoch()})
+}
+
+// lookup returns the member currently holding the partition
+func (s *coreService) lookup(id PartitionID) (NodeInfo, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	holder := s.partitions[id].state.holder()
+	if holder == "" {
+		return NodeInfo{}, false
+	}
+	for _, n := range s.nodes {
+		if n.name == holder {
+			return NodeInfo{
+				Name:   n.name,
+				Addr:   n.addr,
+				Weight: n.meta.getWeight(),
+				Labels: n.meta.labels,
+			}, true
+		}
+	}
+	return NodeInfo{}, false
+}
+
+func (s *coreService) currentEpoch(id PartitionID) Epoch {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.partitions[id].state.epoch()
+}
+
+func (s *coreService) completeStarting(id PartitionID, seq uint64, err error) {
+	s.lock()
+	defer s.unlock()
+
+	if !s.endOperation(id, seq) {
+		s.abandonedStartCompleted(id, seq, err)
+		return
+	}
+
+	if cancel := s.cancels[id]; cancel != nil {
+		cancel()
+		s.cancels[id] = nil
+	}
+
+	s.observe(id, func(p *partition) {
+		if err != nil {
+			p.startFailed()
+		} else {
+			p.completeStarting()
+		}
+	})
+	s.updateStandby(id)
+}
+
+func (s *coreService) completeStopping(id PartitionID, seq uint64, err error) {
+	s.lock()
+	defer s.unlock()
+
+	if !s.endOperation(id, seq) {
+		return
+	}
+
+	prevHolder := s.partitions[id].state.holder()
+	s.observe(id, func(p *partition) {
+		if err != nil {
+			p.stopFailed()
+		} else {
+			p.completeStopping()
+		}
+	})
+	s.updateStandby(id)
+	s.migrationReleased(id, prevHolder)
+	s.unhealthyReleased(id)
+}
+
+func (s *coreService) retry(id PartitionID) {
+	s.lock()
+	defer s.unlock()
+
+	s.observe(id, func(p *partition) {
+		p.retry()
+	})
+	s.updateStandby(id)
+}
+
+func (s *coreService) completeStandbyStarting(id PartitionID) {
+	s.lock()
+	defer s.unlock()
+
+	s.replicas[id].completeStarting()
+}
+
+func (s *coreService) completeStandbyStopping(id PartitionID) {
+	s.lock()
+	defer s.unlock()
+
+	s.replicas[id].completeStopping()
+	s.updateStandby(id)
+}
+
+func (d *corePartitionDelegate) start(epoch Epoch) {
+	seq := d.core.beginOperation(d.id, OperationStart)
+
+	if d.core.replicaRunner != nil && d.core.replicas[d.id].promote() {
+		d.core.addPending(func() {
+			d.core.replicaRunner.Promote(d.id, epoch, func() {
+				d.core.completeStarting(d.id, seq, nil)
+			})
+		})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.core.cancels[d.id] = cancel
+
+	info := PartitionInfo{ID: d.id, Epoch: epoch}
+	d.core.addPending(func() {
+		d.core.runner.start(ctx, info, func(err error) {
+			d.core.completeStarting(d.id, seq, err)
+		})
+	})
+}
+
+func (d *corePartitionDelegate) stop() {
+	seq := d.core.beginOperation(d.id, OperationStop)
+
+	p := &d.core.partitions[d.id]
+	info := PartitionInfo{
+		ID:    d.id,
+		Epoch: Epoch{Incarnation: p.startingIncarnation, Node: d.core.selfNode},
+	}
+	d.core.addPending(func() {
+		d.core.runner.stop(context.Background(), info, func(err error) {
+			d.core.completeStopping(d.id, seq, err)
+		})
+	})
+}
+
+func (d *corePartitionDelegate) cancelStart() {
+	if cancel := d.core.cancels[d.id]; cancel != nil {
+		cancel()
+	}
+}
+
+func (d *corePartitionDelegate) scheduleRetry(failures int) {
+	if timer := d.core.retryTimers[d.id]; timer != nil {
+		timer.Stop()
+	}
+
+	if d.core.closed {
+		return
+	}
+
+	opts := d.core.options
+	delay := computeBackoff(opts.retryMinDelay, opts.retryMaxDelay, failures)
+	d.core.retryTimers[d.id] = opts.clock.NewTimer(delay, func() {
+		d.core.retry(d.id)
+	})
+}
+
+func (d *corePartitionDelegate) broadcast(msg partitionMsg) {
+	d.core.outgoing = append(d.core.outgoing, partitionEntry{id: d.id, msg: msg})
+}
+
+func (d *coreReplicaDelegate) startStandby() {
+	d.core.addPending(func() {
+		d.core.replicaRunner.StartStandby(d.id, func() {
+			d.core.completeStandbyStarting(d.id)
+		})
+	})
+}
+
+func (d *coreReplicaDelegate) stopStandby() {
+	d.core.addPending(func() {
+		d.core.replicaRunner.StopStandby(d.id, func() {
+			d.core.completeStandbyStopping(d.id)
+		})
+	})
 }
@@ -1 +1,419 @@
 package shim
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type coreServiceTest struct {
+	core   *coreService
+	runner *PartitionRunnerMock
+
+	startCompleted map[PartitionID]func()
+	stopCompleted  map[PartitionID]func()
+}
+
+type noopPartitionBroadcaster struct {
+	msgs map[PartitionID]partitionMsg
+}
+
+func (b *noopPartitionBroadcaster) broadcastPartitions(entries []partitionEntry) {
+	for _, e := range entries {
+		b.msgs[e.id] = e.msg
+	}
+}
+
+func newCoreServiceTest(partitionCount int, opts ...Option) *coreServiceTest {
+	runner := &PartitionRunnerMock{}
+	c := &coreServiceTest{
+		runner: runner,
+
+		startCompleted: map[PartitionID]func(){},
+		stopCompleted:  map[PartitionID]func(){},
+	}
+
+	runner.StartFunc = func(partition PartitionID, _ Epoch, startCompleted func()) {
+		c.startCompleted[partition] = startCompleted
+	}
+	runner.StopFunc = func(partition PartitionID, stopCompleted func()) {
+		c.stopCompleted[partition] = stopCompleted
+	}
+
+	broadcaster := &noopPartitionBroadcaster{msgs: map[PartitionID]partitionMsg{}}
+	c.core = newCoreService(partitionCount, "node01", "address01", newCallbackRunner(runner), broadcaster, nil, computeOptions(opts...))
+	return c
+}
+
+func (c *coreServiceTest) startedPartitions() []PartitionID {
+	var result []PartitionID
+	for _, call := range c.runner.StartCalls() {
+		result = append(result, call.Partition)
+	}
+	return result
+}
+
+func (c *coreServiceTest) stoppedPartitions() []PartitionID {
+	var result []PartitionID
+	for _, call := range c.runner.StopCalls() {
+		result = append(result, call.Partition)
+	}
+	return result
+}
+
+func TestCoreService_Not_Join_Completed__Not_Start(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+
+	assert.Equal(t, 0, len(c.runner.StartCalls()))
+}
+
+func TestCoreService_Join_Completed__Start_All(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onJoinCompleted()
+
+	assert.Equal(t, []PartitionID{0, 1, 2, 3}, c.startedPartitions())
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, partitionStatusStarting, c.core.partitions[i].state.status)
+	}
+}
+
+func TestCoreService_Start_Completed__Running(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onJoinCompleted()
+	c.startCompleted[2]()
+
+	assert.Equal(t, partitionState{
+		status:      partitionStatusRunning,
+		owner:       "node01",
+		incarnation: 1,
+		current:     "node01",
+	}, c.core.partitions[2].state)
+
+	broadcaster := c.core.broadcaster.(*noopPartitionBroadcaster)
+	assert.Equal(t, map[PartitionID]partitionMsg{
+		2: {incarnation: 1, current: "node01"},
+	}, broadcaster.msgs)
+}
+
+func TestCoreService_Node_Join__Stop_Reallocated_Partitions(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onJoinCompleted()
+	for i := 0; i < 4; i++ {
+		c.startCompleted[PartitionID(i)]()
+	}
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+	assert.Equal(t, "node02", c.core.partitions[2].state.owner)
+	assert.Equal(t, partitionStatusStopping, c.core.partitions[2].state.status)
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[1].state.status)
+
+	c.stopCompleted[2]()
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[2].state.status)
+	assert.Equal(t, true, c.core.partitions[2].state.left)
+}
+
+func TestCoreService_Node_Leave__Start_Partitions_Of_Left_Node(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 2, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+
+	assert.Equal(t, []PartitionID{0, 1, 2, 3}, c.startedPartitions())
+	assert.Equal(t, true, c.core.partitions[3].state.left)
+}
+
+func TestCoreService_Runner_Complete_Synchronously(t *testing.T) {
+	c := newCoreServiceTest(2)
+
+	c.runner.StartFunc = func(partition PartitionID, _ Epoch, startCompleted func()) {
+		startCompleted()
+	}
+
+	c.core.onJoinCompleted()
+
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[0].state.status)
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[1].state.status)
+}
+
+func TestCoreService_Snapshot(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onJoinCompleted()
+	c.startCompleted[1]()
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 3, msg: partitionMsg{incarnation: 2, current: "node02", left: true}},
+	})
+
+	assert.Equal(t, []partitionEntry{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node01"}},
+		{id: 3, msg: partitionMsg{incarnation: 2, current: "node02", left: true}},
+	}, c.core.snapshot())
+}
+
+func TestCoreService_Recv_Holder_Changed__Reallocate(t *testing.T) {
+	c := newCoreServiceTest(4)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 0, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+	c.core.onJoinCompleted()
+
+	assert.Equal(t, []PartitionID{2, 3}, c.startedPartitions())
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	})
+
+	assert.Equal(t, "node02", c.core.partitions[0].state.owner)
+	assert.Equal(t, "node02", c.core.partitions[1].state.owner)
+	assert.Equal(t, "node01", c.core.partitions[2].state.owner)
+	assert.Equal(t, "node01", c.core.partitions[3].state.owner)
+	assert.Equal(t, []PartitionID{2, 3}, c.startedPartitions())
+	assert.Equal(t, []PartitionID(nil), c.stoppedPartitions())
+}
+
+func TestCoreService_Weighted_Nodes(t *testing.T) {
+	c := newCoreServiceTest(8)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02", meta: nodeMeta{weight: 3}},
+	})
+	c.core.onJoinCompleted()
+
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+	for i := 2; i < 8; i++ {
+		assert.Equal(t, "node02", c.core.partitions[i].state.owner)
+	}
+}
+
+type coreReplicaTest struct {
+	core   *coreService
+	runner *ReplicaRunnerMock
+
+	completed map[string]func()
+}
+
+func newCoreReplicaTest(partitionCount int, standbyCount int) *coreReplicaTest {
+	runner := &ReplicaRunnerMock{}
+	c := &coreReplicaTest{
+		runner:    runner,
+		completed: map[string]func(){},
+	}
+
+	register := func(action string) func(partition PartitionID, completed func()) {
+		return func(partition PartitionID, completed func()) {
+			c.completed[fmt.Sprintf("%s-%d", action, partition)] = completed
+		}
+	}
+	withEpoch := func(action string) func(partition PartitionID, _ Epoch, completed func()) {
+		fn := register(action)
+		return func(partition PartitionID, _ Epoch, completed func()) {
+			fn(partition, completed)
+		}
+	}
+	runner.StartFunc = withEpoch("start")
+	runner.StopFunc = register("stop")
+	runner.StartStandbyFunc = register("start-standby")
+	runner.StopStandbyFunc = register("stop-standby")
+	runner.PromoteFunc = withEpoch("promote")
+
+	broadcaster := &noopPartitionBroadcaster{msgs: map[PartitionID]partitionMsg{}}
+	c.core = newCoreService(partitionCount, "node01", "address01", newCallbackRunner(runner), broadcaster, nil,
+		computeOptions(WithStandbyCount(standbyCount)))
+	return c
+}
+
+func TestCoreService_Replica__Start_Standbys_Of_Other_Nodes(t *testing.T) {
+	c := newCoreReplicaTest(4, 1)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+
+	var started []PartitionID
+	for _, call := range c.runner.StartCalls() {
+		started = append(started, call.Partition)
+	}
+	var standbys []PartitionID
+	for _, call := range c.runner.StartStandbyCalls() {
+		standbys = append(standbys, call.Partition)
+	}
+
+	assert.Equal(t, []PartitionID{0, 1}, started)
+	assert.Equal(t, []PartitionID{2, 3}, standbys)
+	assert.Equal(t, []string{"node01"}, c.core.standbys[2])
+	assert.Equal(t, []string{"node02"}, c.core.standbys[0])
+}
+
+func TestCoreService_Replica__Holder_Left__Promote_Standby(t *testing.T) {
+	c := newCoreReplicaTest(4, 1)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+	c.completed["start-standby-2"]()
+	c.completed["start-standby-3"]()
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 2, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+
+	var promoted []PartitionID
+	for _, call := range c.runner.PromoteCalls() {
+		promoted = append(promoted, call.Partition)
+	}
+	assert.Equal(t, []PartitionID{2, 3}, promoted)
+	assert.Equal(t, 2, len(c.runner.StartCalls()))
+	assert.Equal(t, 0, len(c.runner.StopStandbyCalls()))
+	assert.Equal(t, replicaStatusStopped, c.core.replicas[2].status)
+
+	c.completed["promote-2"]()
+	assert.Equal(t, partitionState{
+		status:      partitionStatusRunning,
+		owner:       "node01",
+		incarnation: 2,
+		current:     "node01",
+	}, c.core.partitions[2].state)
+}
+
+func TestCoreService_Replica__Standby_Not_Ready__Cold_Start(t *testing.T) {
+	c := newCoreReplicaTest(4, 1)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+
+	assert.Equal(t, 0, len(c.runner.PromoteCalls()))
+	assert.Equal(t, 4, len(c.runner.StartCalls()))
+
+	c.completed["start-standby-2"]()
+	assert.Equal(t, 1, len(c.runner.StopStandbyCalls()))
+	assert.Equal(t, PartitionID(2), c.runner.StopStandbyCalls()[0].Partition)
+}
+
+func TestCoreService_Runner_Without_Replicas__No_Standbys(t *testing.T) {
+	c := newCoreServiceTest(4)
+	c.core.options.standbyCount = 1
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+
+	assert.Nil(t, c.core.replicaRunner)
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+	assert.Nil(t, c.core.standbys[2])
+}
+
+func TestCoreService_Leaving_Node__Keep_Holding_Until_Stopped(t *testing.T) {
+	c := newCoreServiceTest(4)
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 2, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02", leaving: true},
+	})
+
+	assert.Equal(t, "node01", c.core.partitions[2].state.owner)
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 2, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	})
+	assert.Equal(t, []PartitionID{0, 1, 2}, c.startedPartitions())
+
+	// the leaving node is removed before stopping partition 3
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+	assert.Equal(t, []PartitionID{0, 1, 2, 3}, c.startedPartitions())
+}
+
+func TestCoreService_Shutdown__Drained_After_All_Stopped(t *testing.T) {
+	c := newCoreServiceTest(3)
+	c.core.onJoinCompleted()
+	c.startCompleted[0]()
+	c.startCompleted[1]()
+
+	drained := 0
+	c.core.shutdown(func() {
+		drained++
+	})
+
+	assert.Equal(t, []PartitionID{0, 1}, c.stoppedPartitions())
+	assert.Equal(t, 0, drained)
+
+	c.stopCompleted[0]()
+	c.stopCompleted[1]()
+	assert.Equal(t, 0, drained)
+
+	// partition 2 was starting
+	c.startCompleted[2]()
+	assert.Equal(t, []PartitionID{0, 1, 2}, c.stoppedPartitions())
+	c.stopCompleted[2]()
+	assert.Equal(t, 1, drained)
+
+	broadcaster := c.core.broadcaster.(*noopPartitionBroadcaster)
+	assert.Equal(t, partitionMsg{incarnation: 1, current: "node01", left: true}, broadcaster.msgs[2])
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+	})
+	assert.Equal(t, 3, len(c.runner.StartCalls()))
+	assert.Equal(t, 1, drained)
+}
@@ -0,0 +1,102 @@
+package shim
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resolver resolves the addresses of DNS discovery, *net.Resolver implements it
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service string, proto string, name string) (string, []*net.SRV, error)
+}
+
+type dnsDiscovery struct {
+	name string
+	port int
+}
+
+// resolveSeeds returns the sorted addresses of the name, with the port when it is not zero,
+// otherwise with the ports of the SRV records of the name
+func resolveSeeds(ctx context.Context, resolver Resolver, name string, port int) ([]string, error) {
+	var addrs []string
+	if port > 0 {
+		hosts, err := resolver.LookupHost(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hosts {
+			addrs = append(addrs, net.JoinHostPort(h, strconv.Itoa(port)))
+		}
+		return sortAddrs(addrs), nil
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, r := range records {
+		hosts, err := resolver.LookupHost(ctx, strings.TrimSuffix(r.Target, "."))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, h := range hosts {
+			addrs = append(addrs, net.JoinHostPort(h, strconv.Itoa(int(r.Port))))
+		}
+	}
+	if len(addrs) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return sortAddrs(addrs), nil
+}
+
+func sortAddrs(addrs []string) []string {
+	sort.Strings(addrs)
+
+	result := addrs[:0]
+	for i, a := range addrs {
+		if i > 0 && a == addrs[i-1] {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
+// discover resolves the seeds periodically, the first join waits for the first resolution
+func (s *Service) discover() {
+	s.mut.Lock()
+	if s.closed {
+		s.mut.Unlock()
+		return
+	}
+	s.mut.Unlock()
+
+	d := s.options.dnsDiscovery
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.dnsRefreshInterval)
+	addrs, err := resolveSeeds(ctx, s.options.resolver, d.name, d.port)
+	cancel()
+
+	changed := false
+	if err == nil {
+		changed = s.joinMgr.setDiscoveredAddrs(addrs)
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.closed {
+		return
+	}
+	if !s.discovered || changed {
+		s.discovered = true
+		s.restartJoin()
+	}
+	s.discoveryTimer = s.options.clock.NewTimer(s.options.dnsRefreshInterval, s.discover)
+}
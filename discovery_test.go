@@ -0,0 +1,208 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+	err   error
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	hosts, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return hosts, nil
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, _ string, _ string, name string) (string, []*net.SRV, error) {
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return name, r.srvs[name], nil
+}
+
+func TestResolveSeeds_Host(t *testing.T) {
+	r := &fakeResolver{
+		hosts: map[string][]string{
+			"shim.default.svc": {"10.0.0.2", "10.0.0.1", "fd00::1", "10.0.0.2"},
+		},
+	}
+
+	addrs, err := resolveSeeds(context.Background(), r, "shim.default.svc", 7946)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"10.0.0.1:7946", "10.0.0.2:7946", "[fd00::1]:7946"}, addrs)
+
+	_, err = resolveSeeds(context.Background(), r, "other.default.svc", 7946)
+	assert.Error(t, err)
+}
+
+func TestResolveSeeds_SRV(t *testing.T) {
+	r := &fakeResolver{
+		hosts: map[string][]string{
+			"shim-0.shim.default.svc": {"10.0.0.1"},
+			"shim-1.shim.default.svc": {"10.0.0.2"},
+		},
+		srvs: map[string][]*net.SRV{
+			"_gossip._tcp.shim.default.svc": {
+				{Target: "shim-1.shim.default.svc.", Port: 7001},
+				{Target: "shim-0.shim.default.svc.", Port: 7000},
+				{Target: "shim-2.shim.default.svc.", Port: 7002},
+			},
+		},
+	}
+
+	addrs, err := resolveSeeds(context.Background(), r, "_gossip._tcp.shim.default.svc", 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"10.0.0.1:7000", "10.0.0.2:7001"}, addrs)
+
+	r.err = errors.New("dns failed")
+	_, err = resolveSeeds(context.Background(), r, "_gossip._tcp.shim.default.svc", 0)
+	assert.Equal(t, r.err, err)
+}
+
+func TestService_DNS_Discovery__Join_Resolved_Addresses(t *testing.T) {
+	resolver := &fakeResolver{
+		hosts: map[string][]string{
+			"shim.default.svc": {"10.0.0.1", "10.0.0.2"},
+		},
+	}
+	delegate := &NodeDelegateMock{
+		JoinFunc:      func(addrs []string) error { return nil },
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "10.0.0.1:7946", &PartitionRunnerMock{},
+		WithStaticAddresses([]string{"10.0.0.9:7946"}),
+		WithDNSDiscovery("shim.default.svc", 7946, 10*time.Second),
+		WithResolver(resolver),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+	)
+	s.joinMgr.listener = &nodeListenerMock{
+		onChangeFunc:        func(nodes []nodeInfo) {},
+		onJoinCompletedFunc: func() {},
+	}
+	s.Start()
+	clock.advance(0)
+
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+	assert.Equal(t, []string{"10.0.0.2:7946", "10.0.0.9:7946"}, delegate.JoinCalls()[0].Addrs)
+
+	s.NotifyJoin("node02", "10.0.0.2:7946", nil)
+	s.NotifyJoin("node09", "10.0.0.9:7946", nil)
+
+	// resolution failures keep the previous addresses
+	resolver.err = errors.New("dns failed")
+	clock.advance(10 * time.Second)
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+
+	// a new pod is joined without waiting for the rejoin interval
+	resolver.err = nil
+	resolver.hosts["shim.default.svc"] = []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	clock.advance(10 * time.Second)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+	assert.Equal(t, []string{"10.0.0.3:7946"}, delegate.JoinCalls()[1].Addrs)
+
+	shutdownService(t, s)
+
+	resolver.hosts["shim.default.svc"] = []string{"10.0.0.4"}
+	clock.advance(time.Hour)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+}
+
+func TestService_DNS_Discovery__Restart_Join__Single_Join_Loop(t *testing.T) {
+	resolver := &fakeResolver{
+		hosts: map[string][]string{
+			"shim.default.svc": {"10.0.0.2"},
+		},
+	}
+	delegate := &NodeDelegateMock{
+		JoinFunc:      func(addrs []string) error { return nil },
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "10.0.0.1:7946", &PartitionRunnerMock{},
+		WithDNSDiscovery("shim.default.svc", 7946, 10*time.Second),
+		WithRejoinInterval(time.Minute),
+		WithResolver(resolver),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+	)
+	s.joinMgr.listener = &nodeListenerMock{
+		onChangeFunc:        func(nodes []nodeInfo) {},
+		onJoinCompletedFunc: func() {},
+	}
+	s.Start()
+	clock.advance(0)
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+
+	s.mut.Lock()
+	staleGen := s.joinGen
+	s.mut.Unlock()
+
+	resolver.hosts["shim.default.svc"] = []string{"10.0.0.2", "10.0.0.3"}
+	clock.advance(10 * time.Second)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+
+	// the join of the previous loop fired while discover was restarting the loop
+	s.join(staleGen)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+
+	clock.advance(time.Minute)
+	assert.Equal(t, 3, len(delegate.JoinCalls()))
+
+	shutdownService(t, s)
+}
+
+func TestService_Restart_Join_While_Joining__Join_Again_Once_Completed(t *testing.T) {
+	var s *Service
+	delegate := &NodeDelegateMock{
+		JoinFunc: func(addrs []string) error {
+			// the addresses are discovered again while joining
+			s.mut.Lock()
+			if s.joinGen == 0 {
+				s.restartJoin()
+			}
+			s.mut.Unlock()
+			return nil
+		},
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s = New(2, "node01", "address01", &PartitionRunnerMock{},
+		WithStaticAddresses([]string{"address02"}),
+		WithRejoinInterval(time.Minute),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+	)
+	s.joinMgr.listener = &nodeListenerMock{
+		onChangeFunc:        func(nodes []nodeInfo) {},
+		onJoinCompletedFunc: func() {},
+	}
+	s.Start()
+	clock.advance(0)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+
+	clock.advance(time.Minute)
+	assert.Equal(t, 3, len(delegate.JoinCalls()))
+
+	shutdownService(t, s)
+}
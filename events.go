@@ -0,0 +1,165 @@
+package shim
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType ...
+type EventType int
+
+const (
+	// EventOwnerAssigned is published when a partition is allocated to a node, Node is the new owner
+	EventOwnerAssigned EventType = iota + 1
+	// EventStarted is published when a node is known to hold a partition, Node is the holder.
+	// It replaces the previous holder, if any
+	EventStarted
+	// EventStopped is published when the holder of a partition released it, Node is the previous holder
+	EventStopped
+	// EventNodeJoined is published when a node joins the cluster
+	EventNodeJoined
+	// EventNodeLeft is published when a node is removed from the cluster, e.g. it crashed
+	EventNodeLeft
+	// EventNodeGracefullyLeft is published when a node left the cluster by shutting down
+	EventNodeGracefullyLeft
+	// EventHandoffCompleted is published when this node stops waiting for the previous holder of a partition
+	// to release it and starts the partition. Node and Epoch are of the previous holder, Duration is the wait.
+	// Forced is set when the previous holder did not release it before the handoff timeout
+	EventHandoffCompleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventOwnerAssigned:
+		return "owner-assigned"
+	case EventStarted:
+		return "started"
+	case EventStopped:
+		return "stopped"
+	case EventNodeJoined:
+		return "node-joined"
+	case EventNodeLeft:
+		return "node-left"
+	case EventNodeGracefullyLeft:
+		return "node-gracefully-left"
+	case EventHandoffCompleted:
+		return "handoff-completed"
+	default:
+		return fmt.Sprintf("event(%d)", int(t))
+	}
+}
+
+// Event is an ownership or membership change as seen by the local node.
+// Partition and Epoch are only set for partition events, Duration and Forced for handoff events
+type Event struct {
+	Type      EventType
+	Partition PartitionID
+	Node      string
+	Epoch     Epoch
+
+	Duration time.Duration
+	Forced   bool
+}
+
+// eventDispatcher delivers events to the subscribers in order on its own goroutine,
+// publishers can hold their locks while publishing because handlers are never called by publish.
+// Events published before close are still delivered
+type eventDispatcher struct {
+	mut  sync.Mutex
+	cond *sync.Cond
+
+	queue       []Event
+	subscribers map[uint64]func(Event)
+	nextID      uint64
+	running     bool
+	closed      bool
+}
+
+func newEventDispatcher() *eventDispatcher {
+	d := &eventDispatcher{
+		subscribers: map[uint64]func(Event){},
+	}
+	d.cond = sync.NewCond(&d.mut)
+	return d
+}
+
+func (d *eventDispatcher) publish(e Event) {
+	if d == nil {
+		return
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if d.closed || len(d.subscribers) == 0 {
+		return
+	}
+	d.queue = append(d.queue, e)
+	d.cond.Signal()
+}
+
+func (d *eventDispatcher) subscribe(handler func(Event)) func() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	d.nextID++
+	id := d.nextID
+	d.subscribers[id] = handler
+
+	if !d.running && !d.closed {
+		d.running = true
+		go d.run()
+	}
+
+	return func() {
+		d.mut.Lock()
+		defer d.mut.Unlock()
+
+		delete(d.subscribers, id)
+	}
+}
+
+func (d *eventDispatcher) close() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	d.closed = true
+	d.cond.Signal()
+}
+
+func (d *eventDispatcher) run() {
+	for {
+		d.mut.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			d.mut.Unlock()
+			return
+		}
+
+		events := d.queue
+		d.queue = nil
+
+		ids := make([]uint64, 0, len(d.subscribers))
+		for id := range d.subscribers {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+		handlers := make([]func(Event), 0, len(ids))
+		for _, id := range ids {
+			handlers = append(handlers, d.subscribers[id])
+		}
+		d.mut.Unlock()
+
+		for _, e := range events {
+			for _, handler := range handlers {
+				handler(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type eventCollector struct {
+	ch chan Event
+}
+
+func newEventCollector(d *eventDispatcher) (*eventCollector, func()) {
+	c := &eventCollector{ch: make(chan Event, 1024)}
+	unsubscribe := d.subscribe(func(e Event) {
+		c.ch <- e
+	})
+	return c, unsubscribe
+}
+
+func (c *eventCollector) next(t *testing.T, n int) []Event {
+	result := make([]Event, 0, n)
+	for len(result) < n {
+		select {
+		case e := <-c.ch:
+			result = append(result, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d events, got %v", n, result)
+		}
+	}
+	return result
+}
+
+func (c *eventCollector) assertNoMore(t *testing.T) {
+	select {
+	case e := <-c.ch:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	assert.Equal(t, "owner-assigned", EventOwnerAssigned.String())
+	assert.Equal(t, "node-gracefully-left", EventNodeGracefullyLeft.String())
+	assert.Equal(t, "event(0)", EventType(0).String())
+}
+
+func TestEventDispatcher_Publish_In_Order(t *testing.T) {
+	d := newEventDispatcher()
+	defer d.close()
+
+	d.publish(Event{Type: EventNodeJoined, Node: "dropped"})
+
+	c1, unsubscribe1 := newEventCollector(d)
+	c2, unsubscribe2 := newEventCollector(d)
+	defer unsubscribe2()
+
+	for i := 0; i < 100; i++ {
+		d.publish(Event{Type: EventStarted, Partition: PartitionID(i)})
+	}
+
+	for _, c := range []*eventCollector{c1, c2} {
+		events := c.next(t, 100)
+		for i, e := range events {
+			assert.Equal(t, PartitionID(i), e.Partition)
+		}
+	}
+
+	unsubscribe1()
+	d.publish(Event{Type: EventStopped})
+	assert.Equal(t, []Event{{Type: EventStopped}}, c2.next(t, 1))
+	c1.assertNoMore(t)
+}
+
+func TestEventDispatcher_Closed__No_Events(t *testing.T) {
+	d := newEventDispatcher()
+	c, _ := newEventCollector(d)
+
+	d.close()
+	d.publish(Event{Type: EventStopped})
+	c.assertNoMore(t)
+
+	var nilDispatcher *eventDispatcher
+	nilDispatcher.publish(Event{Type: EventStopped})
+}
+
+func TestCoreService_Partition_Events(t *testing.T) {
+	d := newEventDispatcher()
+	defer d.close()
+	events, _ := newEventCollector(d)
+
+	c := newCoreServiceTest(2)
+	c.core.events = d
+
+	c.core.onJoinCompleted()
+	assert.Equal(t, []Event{
+		{Type: EventOwnerAssigned, Partition: 0, Node: "node01"},
+		{Type: EventOwnerAssigned, Partition: 1, Node: "node01"},
+	}, events.next(t, 2))
+
+	c.startCompleted[1]()
+	epoch := Epoch{Incarnation: 1, Node: "node01"}
+	assert.Equal(t, []Event{
+		{Type: EventStarted, Partition: 1, Node: "node01", Epoch: epoch},
+	}, events.next(t, 1))
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	assert.Equal(t, []Event{
+		{Type: EventOwnerAssigned, Partition: 1, Node: "node02"},
+	}, events.next(t, 1))
+
+	c.stopCompleted[1]()
+	assert.Equal(t, []Event{
+		{Type: EventStopped, Partition: 1, Node: "node01", Epoch: epoch},
+	}, events.next(t, 1))
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 1, msg: partitionMsg{incarnation: 2, current: "node02"}},
+	})
+	assert.Equal(t, []Event{
+		{Type: EventStarted, Partition: 1, Node: "node02", Epoch: Epoch{Incarnation: 2, Node: "node02"}},
+	}, events.next(t, 1))
+	events.assertNoMore(t)
+}
+
+func TestNodeJoinManager_Node_Events(t *testing.T) {
+	d := newEventDispatcher()
+	defer d.close()
+	events, _ := newEventCollector(d)
+
+	listener := &nodeListenerMock{
+		onChangeFunc: func(nodes []nodeInfo) {},
+	}
+	broadcaster := &nodeBroadcasterMock{
+		broadcastFunc: func(msg nodeLeftMsg) {},
+	}
+	m := newNodeJoinManager("self-node", "address01", listener, broadcaster, d, computeOptions())
+
+	m.notifyJoin("other02", "address02", nodeMeta{})
+	m.notifyJoin("other03", "address03", nodeMeta{})
+	m.notifyJoin("other03", "address03", nodeMeta{weight: 2})
+	m.notifyMsg(nodeLeftMsg{name: "other02", addr: "address02"})
+	m.notifyLeave("other02")
+	m.notifyLeave("other03")
+
+	assert.Equal(t, []Event{
+		{Type: EventNodeJoined, Node: "other02"},
+		{Type: EventNodeJoined, Node: "other03"},
+		{Type: EventNodeGracefullyLeft, Node: "other02"},
+		{Type: EventNodeLeft, Node: "other03"},
+	}, events.next(t, 4))
+	events.assertNoMore(t)
+}
+
+func TestService_Subscribe(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+		StopFunc: func(partition PartitionID, stopCompleted func()) {
+			stopCompleted()
+		},
+	}
+
+	s := New(1, "node01", "address01", runner)
+	ch := make(chan Event, 16)
+	unsubscribe := s.Subscribe(func(e Event) {
+		ch <- e
+	})
+	defer unsubscribe()
+
+	s.Start()
+
+	epoch := Epoch{Incarnation: 1, Node: "node01"}
+	assert.Equal(t, Event{Type: EventOwnerAssigned, Node: "node01"}, <-ch)
+	assert.Equal(t, Event{Type: EventStarted, Node: "node01", Epoch: epoch}, <-ch)
+
+	shutdownService(t, s)
+	assert.Equal(t, Event{Type: EventStopped, Node: "node01", Epoch: epoch}, <-ch)
+}
@@ -0,0 +1,200 @@
+package gossip
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/QuangTung97/shim"
+	"github.com/hashicorp/memberlist"
+)
+
+// Handler receives membership events and messages from the gossip layer, it is implemented by *shim.Service
+type Handler interface {
+	NodeMeta() []byte
+	NotifyJoin(name string, addr string, meta []byte)
+	NotifyLeave(name string)
+	NotifyMsg(msg []byte)
+	LocalState() []byte
+	MergeRemoteState(state []byte)
+}
+
+// ErrNotStarted is returned by Join when Start has not been called or has failed
+var ErrNotStarted = errors.New("gossip: adapter not started")
+
+// Adapter connects a shim.Service to a hashicorp/memberlist cluster
+type Adapter struct {
+	mut sync.Mutex
+
+	conf    *memberlist.Config
+	handler Handler
+
+	list  *memberlist.Memberlist
+	queue *memberlist.TransmitLimitedQueue
+
+	leaveTimeout time.Duration
+}
+
+var _ shim.NodeDelegate = &Adapter{}
+var _ memberlist.Delegate = &memberlistDelegate{}
+var _ memberlist.EventDelegate = &memberlistDelegate{}
+
+type memberlistDelegate struct {
+	adapter *Adapter
+}
+
+type broadcast struct {
+	msg []byte
+}
+
+// New creates an adapter, the memberlist is not created until Start is called
+func New(conf *memberlist.Config) *Adapter {
+	a := &Adapter{
+		conf:         conf,
+		leaveTimeout: 5 * time.Second,
+	}
+	a.queue = &memberlist.TransmitLimitedQueue{
+		NumNodes:       a.numNodes,
+		RetransmitMult: conf.RetransmitMult,
+	}
+	return a
+}
+
+// Start creates the memberlist and delivers its events to the handler
+func (a *Adapter) Start(handler Handler) error {
+	a.handler = handler
+
+	delegate := &memberlistDelegate{adapter: a}
+	a.conf.Delegate = delegate
+	a.conf.Events = delegate
+
+	list, err := memberlist.Create(a.conf)
+	if err != nil {
+		return err
+	}
+
+	a.mut.Lock()
+	a.list = list
+	a.mut.Unlock()
+	return nil
+}
+
+// LocalAddress returns the address of the local node, in the form used by the static addresses.
+// It is empty before Start
+func (a *Adapter) LocalAddress() string {
+	list := a.getList()
+	if list == nil {
+		return ""
+	}
+	return list.LocalNode().Address()
+}
+
+// Join implements shim.NodeDelegate
+func (a *Adapter) Join(addrs []string) error {
+	list := a.getList()
+	if list == nil {
+		return ErrNotStarted
+	}
+	_, err := list.Join(addrs)
+	return err
+}
+
+// Leave implements shim.NodeDelegate, it does nothing when the adapter is not started
+func (a *Adapter) Leave() {
+	list := a.getList()
+	if list == nil {
+		return
+	}
+
+	a.waitBroadcasts(a.leaveTimeout)
+	_ = list.Leave(a.leaveTimeout)
+	_ = list.Shutdown()
+}
+
+// waitBroadcasts waits until the queued broadcasts are transmitted, e.g. the partition stop messages
+// sent while shutting down, so that other nodes learn about them before this node leaves
+func (a *Adapter) waitBroadcasts(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for a.queue.NumQueued() > 0 && a.numNodes() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Broadcast implements shim.NodeDelegate
+func (a *Adapter) Broadcast(msg []byte) {
+	a.queue.QueueBroadcast(&broadcast{msg: msg})
+}
+
+func (a *Adapter) getList() *memberlist.Memberlist {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return a.list
+}
+
+func (a *Adapter) numNodes() int {
+	list := a.getList()
+	if list == nil {
+		return 1
+	}
+	return list.NumMembers()
+}
+
+func (d *memberlistDelegate) NodeMeta(limit int) []byte {
+	meta := d.adapter.handler.NodeMeta()
+	if len(meta) > limit {
+		return nil
+	}
+	return meta
+}
+
+func (d *memberlistDelegate) NotifyMsg(msg []byte) {
+	d.adapter.handler.NotifyMsg(copyBytes(msg))
+}
+
+func (d *memberlistDelegate) GetBroadcasts(overhead, limit int) [][]byte {
+	return d.adapter.queue.GetBroadcasts(overhead, limit)
+}
+
+func (d *memberlistDelegate) LocalState(bool) []byte {
+	return d.adapter.handler.LocalState()
+}
+
+func (d *memberlistDelegate) MergeRemoteState(buf []byte, _ bool) {
+	d.adapter.handler.MergeRemoteState(copyBytes(buf))
+}
+
+func (d *memberlistDelegate) NotifyJoin(node *memberlist.Node) {
+	d.adapter.handler.NotifyJoin(node.Name, node.Address(), copyBytes(node.Meta))
+}
+
+func (d *memberlistDelegate) NotifyLeave(node *memberlist.Node) {
+	d.adapter.handler.NotifyLeave(node.Name)
+}
+
+func (d *memberlistDelegate) NotifyUpdate(node *memberlist.Node) {
+	d.adapter.handler.NotifyJoin(node.Name, node.Address(), copyBytes(node.Meta))
+}
+
+func (b *broadcast) Invalidates(memberlist.Broadcast) bool {
+	return false
+}
+
+func (b *broadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *broadcast) Finished() {
+}
+
+// UniqueBroadcast marks that a broadcast never invalidates other broadcasts
+func (b *broadcast) UniqueBroadcast() {
+}
+
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	result := make([]byte, len(data))
+	copy(result, data)
+	return result
+}
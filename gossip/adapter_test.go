@@ -0,0 +1,257 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuangTung97/shim"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRunner struct {
+	mut     sync.Mutex
+	running map[shim.PartitionID]struct{}
+}
+
+func newTestRunner() *testRunner {
+	return &testRunner{running: map[shim.PartitionID]struct{}{}}
+}
+
+func (r *testRunner) Start(partition shim.PartitionID, _ shim.Epoch, startCompleted func()) {
+	r.mut.Lock()
+	r.running[partition] = struct{}{}
+	r.mut.Unlock()
+	startCompleted()
+}
+
+func (r *testRunner) Stop(partition shim.PartitionID, stopCompleted func()) {
+	r.mut.Lock()
+	delete(r.running, partition)
+	r.mut.Unlock()
+	stopCompleted()
+}
+
+func (r *testRunner) getRunning() map[shim.PartitionID]struct{} {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	result := map[shim.PartitionID]struct{}{}
+	for p := range r.running {
+		result[p] = struct{}{}
+	}
+	return result
+}
+
+type testNode struct {
+	adapter *Adapter
+	service *shim.Service
+	runner  *testRunner
+}
+
+func freePort(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	_ = conn.Close()
+	return port
+}
+
+func newTestNode(t *testing.T, name string, port int, staticAddrs []string) *testNode {
+	conf := memberlist.DefaultLocalConfig()
+	conf.Name = name
+	conf.BindAddr = "127.0.0.1"
+	conf.BindPort = port
+	conf.AdvertisePort = port
+	conf.LogOutput = ioutil.Discard
+	conf.PushPullInterval = 200 * time.Millisecond
+
+	adapter := New(conf)
+	runner := newTestRunner()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	service := shim.New(8, name, addr, runner,
+		shim.WithStaticAddresses(staticAddrs),
+		shim.WithNodeDelegate(adapter),
+	)
+
+	err := adapter.Start(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, addr, adapter.LocalAddress())
+
+	return &testNode{
+		adapter: adapter,
+		service: service,
+		runner:  runner,
+	}
+}
+
+func allRunningExactlyOnce(nodes []*testNode, partitionCount int) bool {
+	counter := map[shim.PartitionID]int{}
+	for _, n := range nodes {
+		for p := range n.runner.getRunning() {
+			counter[p]++
+		}
+	}
+	if len(counter) != partitionCount {
+		return false
+	}
+	for _, c := range counter {
+		if c != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func shutdownNode(t *testing.T, n *testNode) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assert.Equal(t, nil, n.service.Shutdown(ctx))
+}
+
+func TestAdapter_Loopback_Cluster__Partitions_Spread_Then_Node_Leave(t *testing.T) {
+	seedPort := freePort(t)
+	seedAddr := fmt.Sprintf("127.0.0.1:%d", seedPort)
+	staticAddrs := []string{seedAddr}
+
+	nodes := []*testNode{
+		newTestNode(t, "node01", seedPort, staticAddrs),
+		newTestNode(t, "node02", freePort(t), staticAddrs),
+	}
+	for _, n := range nodes {
+		n.service.Start()
+	}
+
+	assert.Eventually(t, func() bool {
+		return allRunningExactlyOnce(nodes, 8) &&
+			len(nodes[0].runner.getRunning()) == 4 &&
+			len(nodes[1].runner.getRunning()) == 4
+	}, 10*time.Second, 50*time.Millisecond)
+
+	shutdownNode(t, nodes[1])
+
+	assert.Eventually(t, func() bool {
+		return allRunningExactlyOnce(nodes[:1], 8)
+	}, 10*time.Second, 50*time.Millisecond)
+
+	shutdownNode(t, nodes[0])
+}
+
+type recordHandler struct {
+	mut  sync.Mutex
+	msgs [][]byte
+}
+
+func (h *recordHandler) NodeMeta() []byte {
+	return nil
+}
+
+func (h *recordHandler) NotifyJoin(string, string, []byte) {}
+
+func (h *recordHandler) NotifyLeave(string) {}
+
+func (h *recordHandler) NotifyMsg(msg []byte) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.msgs = append(h.msgs, msg)
+}
+
+func (h *recordHandler) LocalState() []byte {
+	return nil
+}
+
+func (h *recordHandler) MergeRemoteState([]byte) {}
+
+func (h *recordHandler) getMsgs() [][]byte {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return h.msgs
+}
+
+func TestAdapter_Broadcast__Received_By_Other_Node(t *testing.T) {
+	newAdapter := func(name string) (*Adapter, *recordHandler) {
+		port := freePort(t)
+		conf := memberlist.DefaultLocalConfig()
+		conf.Name = name
+		conf.BindAddr = "127.0.0.1"
+		conf.BindPort = port
+		conf.AdvertisePort = port
+		conf.LogOutput = ioutil.Discard
+
+		a := New(conf)
+		h := &recordHandler{}
+		if err := a.Start(h); err != nil {
+			t.Fatal(err)
+		}
+		return a, h
+	}
+
+	a1, _ := newAdapter("node01")
+	a2, h2 := newAdapter("node02")
+
+	err := a2.Join([]string{a1.LocalAddress()})
+	assert.Equal(t, nil, err)
+
+	a1.Broadcast([]byte("hello"))
+
+	assert.Eventually(t, func() bool {
+		return len(h2.getMsgs()) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []byte("hello"), h2.getMsgs()[0])
+
+	a2.Leave()
+	a1.Leave()
+}
+
+func TestAdapter_Loopback_Cluster__Third_Node_Join_Merge_State(t *testing.T) {
+	seedPort := freePort(t)
+	seedAddr := fmt.Sprintf("127.0.0.1:%d", seedPort)
+	staticAddrs := []string{seedAddr}
+
+	nodes := []*testNode{
+		newTestNode(t, "node01", seedPort, staticAddrs),
+		newTestNode(t, "node02", freePort(t), staticAddrs),
+	}
+	for _, n := range nodes {
+		n.service.Start()
+	}
+
+	assert.Eventually(t, func() bool {
+		return allRunningExactlyOnce(nodes, 8) &&
+			len(nodes[0].runner.getRunning()) == 4 &&
+			len(nodes[1].runner.getRunning()) == 4
+	}, 10*time.Second, 50*time.Millisecond)
+
+	nodes = append(nodes, newTestNode(t, "node03", freePort(t), staticAddrs))
+	nodes[2].service.Start()
+
+	assert.Eventually(t, func() bool {
+		return allRunningExactlyOnce(nodes, 8) &&
+			len(nodes[0].runner.getRunning()) == 3 &&
+			len(nodes[1].runner.getRunning()) == 3 &&
+			len(nodes[2].runner.getRunning()) == 2
+	}, 10*time.Second, 50*time.Millisecond)
+
+	for _, n := range nodes {
+		shutdownNode(t, n)
+	}
+}
+
+func TestAdapter_Not_Started__Leave_And_Join_Do_Not_Panic(t *testing.T) {
+	a := New(memberlist.DefaultLocalConfig())
+
+	a.Leave()
+	assert.Equal(t, ErrNotStarted, a.Join([]string{"127.0.0.1:7946"}))
+	assert.Equal(t, "", a.LocalAddress())
+}
@@ -0,0 +1,72 @@
+package shim
+
+import "time"
+
+// handoffWait tracks the wait of this node for the release of a partition by its previous holder
+type handoffWait struct {
+	seq   uint64
+	since time.Time
+	timer Timer
+}
+
+func (s *coreService) handoffTimeout(id PartitionID, seq uint64) {
+	s.lock()
+	defer s.unlock()
+
+	if s.handoffs[id].seq != seq {
+		return
+	}
+	s.observe(id, func(p *partition) {
+		p.expireHandoff()
+	})
+	s.updateStandby(id)
+}
+
+func (d *corePartitionDelegate) waitHandoff() {
+	h := &d.core.handoffs[d.id]
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+
+	h.seq++
+	h.since = d.core.options.clock.Now()
+
+	timeout := d.core.options.handoffTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	seq := h.seq
+	h.timer = d.core.options.clock.NewTimer(timeout, func() {
+		d.core.handoffTimeout(d.id, seq)
+	})
+}
+
+func (d *corePartitionDelegate) handoffCompleted(forced bool) {
+	h := &d.core.handoffs[d.id]
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	h.seq++
+
+	duration := d.core.options.clock.Now().Sub(h.since)
+
+	stats := &d.core.stats
+	stats.Handoffs++
+	stats.HandoffWait += duration
+	if forced {
+		stats.ForcedHandoffs++
+	}
+
+	p := &d.core.partitions[d.id]
+	d.core.events.publish(Event{
+		Type:      EventHandoffCompleted,
+		Partition: d.id,
+		Node:      p.state.current,
+		Epoch:     p.state.epoch(),
+		Duration:  duration,
+		Forced:    forced,
+	})
+}
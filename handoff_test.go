@@ -0,0 +1,185 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPartition_Wait_Handoff__Released__Start(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.waitHandoffFunc = func() {}
+	p.recvBroadcast(partitionMsg{incarnation: 2, current: "other-node"})
+	p.updateOwner("self-node")
+
+	assert.Equal(t, 1, len(delegate.waitHandoffCalls()))
+
+	delegate.handoffCompletedFunc = func(forced bool) {}
+	delegate.startFunc = func(epoch Epoch) {}
+	p.recvBroadcast(partitionMsg{incarnation: 2, current: "other-node", left: true})
+
+	assert.Equal(t, 1, len(delegate.handoffCompletedCalls()))
+	assert.Equal(t, false, delegate.handoffCompletedCalls()[0].Forced)
+	assert.Equal(t, Epoch{Incarnation: 3, Node: "self-node"}, delegate.startCalls()[0].Epoch)
+	assert.Equal(t, partitionState{
+		status:      partitionStatusStarting,
+		owner:       "self-node",
+		incarnation: 2,
+		current:     "other-node",
+		left:        true,
+	}, p.state)
+}
+
+func TestPartition_Wait_Handoff__Expired__Start_With_Newer_Incarnation(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.waitHandoffFunc = func() {}
+	p.recvBroadcast(partitionMsg{incarnation: 2, current: "other-node"})
+	p.updateOwner("self-node")
+
+	delegate.handoffCompletedFunc = func(forced bool) {}
+	delegate.startFunc = func(epoch Epoch) {}
+	p.expireHandoff()
+
+	assert.Equal(t, 1, len(delegate.waitHandoffCalls()))
+	assert.Equal(t, true, delegate.handoffCompletedCalls()[0].Forced)
+	assert.Equal(t, Epoch{Incarnation: 3, Node: "self-node"}, delegate.startCalls()[0].Epoch)
+
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+	p.completeStarting()
+
+	assert.Equal(t, partitionMsg{incarnation: 3, current: "self-node"}, delegate.broadcastCalls()[0].Msg)
+	assert.Equal(t, partitionStatusRunning, p.state.status)
+}
+
+func TestPartition_Wait_Handoff__Owner_Changed__Expire_Ignored(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.waitHandoffFunc = func() {}
+	p.recvBroadcast(partitionMsg{incarnation: 2, current: "other-node"})
+	p.updateOwner("self-node")
+	p.updateOwner("other-node")
+	p.expireHandoff()
+
+	assert.Equal(t, 0, len(delegate.startCalls()))
+	assert.Equal(t, 0, len(delegate.handoffCompletedCalls()))
+	assert.Equal(t, partitionState{
+		owner:       "other-node",
+		incarnation: 2,
+		current:     "other-node",
+	}, p.state)
+}
+
+type handoffTest struct {
+	core   *coreService
+	clock  *fakeClock
+	runner *PartitionRunnerMock
+	events *eventCollector
+
+	broadcaster    *noopPartitionBroadcaster
+	startCompleted []func()
+}
+
+func newHandoffTest(t *testing.T, opts ...Option) *handoffTest {
+	c := &handoffTest{
+		clock:       newFakeClock(),
+		runner:      &PartitionRunnerMock{},
+		broadcaster: &noopPartitionBroadcaster{msgs: map[PartitionID]partitionMsg{}},
+	}
+	c.runner.StartFunc = func(partition PartitionID, _ Epoch, startCompleted func()) {
+		c.startCompleted = append(c.startCompleted, startCompleted)
+	}
+
+	d := newEventDispatcher()
+	t.Cleanup(d.close)
+	c.events, _ = newEventCollector(d)
+
+	opts = append([]Option{WithClock(c.clock)}, opts...)
+	c.core = newCoreService(1, "node01", "address01", newCallbackRunner(c.runner), c.broadcaster, d, computeOptions(opts...))
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 0, msg: partitionMsg{incarnation: 3, current: "node02"}},
+	})
+	c.core.onJoinCompleted()
+	return c
+}
+
+func (c *handoffTest) handoffEvent(t *testing.T) Event {
+	for {
+		e := c.events.next(t, 1)[0]
+		if e.Type == EventHandoffCompleted {
+			return e
+		}
+	}
+}
+
+func TestCoreService_Handoff__Released__Stats_And_Event(t *testing.T) {
+	c := newHandoffTest(t, WithHandoffTimeout(5*time.Second))
+	assert.Equal(t, 0, len(c.runner.StartCalls()))
+
+	c.clock.advance(2 * time.Second)
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 0, msg: partitionMsg{incarnation: 3, current: "node02", left: true}},
+	})
+
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, c.runner.StartCalls()[0].Epoch)
+	assert.Equal(t, Stats{Handoffs: 1, HandoffWait: 2 * time.Second}, c.core.getStats())
+	assert.Equal(t, Event{
+		Type:      EventHandoffCompleted,
+		Partition: 0,
+		Node:      "node02",
+		Epoch:     Epoch{Incarnation: 3, Node: "node02"},
+		Duration:  2 * time.Second,
+	}, c.handoffEvent(t))
+
+	// the timer of the handoff is stopped
+	c.clock.advance(time.Hour)
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+	assert.Equal(t, Stats{Handoffs: 1, HandoffWait: 2 * time.Second}, c.core.getStats())
+}
+
+func TestCoreService_Handoff__Timeout__Take_Over(t *testing.T) {
+	c := newHandoffTest(t, WithHandoffTimeout(5*time.Second))
+
+	c.clock.advance(4999 * time.Millisecond)
+	assert.Equal(t, 0, len(c.runner.StartCalls()))
+
+	c.clock.advance(time.Millisecond)
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, c.runner.StartCalls()[0].Epoch)
+	assert.Equal(t, Stats{
+		Handoffs:       1,
+		ForcedHandoffs: 1,
+		HandoffWait:    5 * time.Second,
+	}, c.core.getStats())
+	assert.Equal(t, Event{
+		Type:      EventHandoffCompleted,
+		Partition: 0,
+		Node:      "node02",
+		Epoch:     Epoch{Incarnation: 3, Node: "node02"},
+		Duration:  5 * time.Second,
+		Forced:    true,
+	}, c.handoffEvent(t))
+
+	c.startCompleted[0]()
+	assert.Equal(t, partitionMsg{incarnation: 4, current: "node01"}, c.broadcaster.msgs[0])
+}
+
+func TestCoreService_Handoff__Without_Timeout__Wait_Forever(t *testing.T) {
+	c := newHandoffTest(t)
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, 0, len(c.runner.StartCalls()))
+	assert.Equal(t, Stats{}, c.core.getStats())
+}
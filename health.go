@@ -0,0 +1,92 @@
+package shim
+
+// reportUnhealthy releases the partition when this node is running it,
+// the release is broadcast as left and unhealthy so that it is allocated to another node
+func (s *coreService) reportUnhealthy(id PartitionID) bool {
+	s.lock()
+	defer s.unlock()
+
+	released := false
+	s.observe(id, func(p *partition) {
+		released = p.reportUnhealthy()
+	})
+	if !released {
+		return false
+	}
+	s.stats.UnhealthyReleases++
+	s.updateStandby(id)
+	return true
+}
+
+// unhealthyReleased reallocates the partition after this node stopped it because it was unhealthy
+func (s *coreService) unhealthyReleased(id PartitionID) {
+	p := &s.partitions[id].state
+	if !p.unhealthy || p.holder() != "" {
+		return
+	}
+	s.reallocate()
+}
+
+// unhealthyTargets chooses another node than the previous holder for the partitions released because they were unhealthy,
+// preferring their first alive standby, otherwise a node chosen by partition id so that all nodes agree on it.
+// The partitions are added to current as if the chosen nodes were holding them
+func (s *coreService) unhealthyTargets(current partitionAssigns, nodes []NodeInfo) map[PartitionID]string {
+	targets := map[PartitionID]string{}
+	for i, p := range s.partitions {
+		if !p.state.unhealthy || p.state.holder() != "" || p.state.status == partitionStatusStarting {
+			continue
+		}
+
+		var others []string
+		for _, n := range nodes {
+			if n.Name != p.state.current {
+				others = append(others, n.Name)
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+
+		next := others[i%len(others)]
+		for _, standby := range s.standbys[i] {
+			if containsNode(others, standby) {
+				next = standby
+				break
+			}
+		}
+		current[next] = append(current[next], PartitionID(i))
+		targets[PartitionID(i)] = next
+	}
+	return targets
+}
+
+// keepUnhealthyTargets overrides the allocation of the released partitions, which may give them back
+// to their previous holder to balance the nodes. They are balanced again once started by the chosen nodes
+func (s *coreService) keepUnhealthyTargets(owners []string, targets map[PartitionID]string) {
+	for id, target := range targets {
+		owners[id] = target
+	}
+}
+
+// recoverUnhealthy runs the partitions this node released again when they are still allocated to it,
+// e.g. it is the only node of the cluster
+func (s *coreService) recoverUnhealthy(owners []string) {
+	for i, owner := range owners {
+		p := &s.partitions[i].state
+		if owner != s.selfNode || !p.unhealthy || p.holder() != "" {
+			continue
+		}
+		s.observe(PartitionID(i), func(p *partition) {
+			p.recovered()
+		})
+	}
+}
+
+func containsNode(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newHealthTest() *coreServiceTest {
+	c := newCoreServiceTest(4)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 2, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+	c.core.onJoinCompleted()
+	c.startCompleted[0]()
+	c.startCompleted[1]()
+	return c
+}
+
+func TestCoreService_Report_Unhealthy__Released_To_Other_Node(t *testing.T) {
+	c := newHealthTest()
+
+	assert.Equal(t, true, c.core.reportUnhealthy(1))
+	assert.Equal(t, []PartitionID{1}, c.stoppedPartitions())
+	assert.Equal(t, uint64(1), c.core.getStats().UnhealthyReleases)
+
+	c.stopCompleted[1]()
+
+	assert.Equal(t, partitionMsg{
+		incarnation: 1, current: "node01", left: true, unhealthy: true,
+	}, c.core.broadcaster.(*noopPartitionBroadcaster).msgs[1])
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[1].state.status)
+	assert.Equal(t, "node02", c.core.partitions[1].state.owner)
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+}
+
+func TestCoreService_Report_Unhealthy__Taken_By_Other_Node__Healthy_Again(t *testing.T) {
+	c := newHealthTest()
+
+	c.core.reportUnhealthy(1)
+	c.stopCompleted[1]()
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 1, msg: partitionMsg{incarnation: 2, current: "node02"}},
+	})
+	assert.Equal(t, false, c.core.partitions[1].state.unhealthy)
+	assert.Equal(t, "node02", c.core.partitions[1].state.holder())
+}
+
+func TestCoreService_Report_Unhealthy__Only_Node__Restarted(t *testing.T) {
+	c := newCoreServiceTest(2)
+	c.core.onJoinCompleted()
+	c.startCompleted[0]()
+	c.startCompleted[1]()
+
+	c.core.reportUnhealthy(1)
+	c.stopCompleted[1]()
+
+	assert.Equal(t, []PartitionID{0, 1, 1}, c.startedPartitions())
+	assert.Equal(t, Epoch{Incarnation: 2, Node: "node01"}, c.runner.StartCalls()[2].Epoch)
+
+	c.startCompleted[1]()
+	assert.Equal(t, partitionMsg{incarnation: 2, current: "node01"}, c.core.broadcaster.(*noopPartitionBroadcaster).msgs[1])
+}
+
+func TestCoreService_Report_Unhealthy__Not_Running__Ignored(t *testing.T) {
+	c := newHealthTest()
+
+	assert.Equal(t, false, c.core.reportUnhealthy(2))
+
+	c.core.reportUnhealthy(1)
+	assert.Equal(t, false, c.core.reportUnhealthy(1))
+
+	assert.Equal(t, []PartitionID{1}, c.stoppedPartitions())
+	assert.Equal(t, uint64(1), c.core.getStats().UnhealthyReleases)
+}
+
+func TestCoreService_Recv_Unhealthy_Release__Allocated_To_Other_Node(t *testing.T) {
+	c := newHealthTest()
+
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node02", left: true, unhealthy: true}},
+	})
+
+	assert.Equal(t, "node01", c.core.partitions[3].state.owner)
+	assert.Equal(t, []PartitionID{0, 1, 3}, c.startedPartitions())
+}
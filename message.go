@@ -0,0 +1,481 @@
+package shim
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+const messageVersion uint8 = 1
+
+type messageType uint8
+
+const (
+	messageTypePartitions messageType = iota + 1
+	messageTypeNodeLeft
+	messageTypePartitionSnapshot
+	messageTypeNodeMeta
+	messageTypeSequencedPartitions
+	messageTypePartitionsAck
+	messageTypeUnhealthyPartitions
+)
+
+const messageHeaderSize = 2
+
+var errInvalidMessage = errors.New("shim: invalid message")
+var errUnsupportedVersion = errors.New("shim: unsupported message version")
+
+type partitionEntry struct {
+	id  PartitionID
+	msg partitionMsg
+}
+
+// partitionBatch is a list of partition messages sent inside a single packet
+type partitionBatch []partitionEntry
+
+// partitionSnapshot is the full state of all known partitions, exchanged for anti-entropy
+type partitionSnapshot []partitionEntry
+
+// unhealthyPartitions are the partitions released because they were reported unhealthy.
+// They are sent in addition to their partition batches under their own type, which older nodes ignore
+type unhealthyPartitions []partitionEntry
+
+type messageDecoder struct {
+	data []byte
+	err  error
+}
+
+func parseMessageHeader(data []byte) (messageType, []byte, error) {
+	if len(data) < messageHeaderSize {
+		return 0, nil, errInvalidMessage
+	}
+	if data[0] != messageVersion {
+		return 0, nil, errUnsupportedVersion
+	}
+	return messageType(data[1]), data[messageHeaderSize:], nil
+}
+
+func appendMessageHeader(data []byte, msgType messageType) []byte {
+	return append(data, messageVersion, byte(msgType))
+}
+
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(data, buf[:n]...)
+}
+
+func appendString(data []byte, s string) []byte {
+	data = appendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func appendBytes(data []byte, b []byte) []byte {
+	data = appendUvarint(data, uint64(len(b)))
+	return append(data, b...)
+}
+
+func appendPartitionEntry(data []byte, e partitionEntry) []byte {
+	data = appendUvarint(data, uint64(e.id))
+	data = appendUvarint(data, e.msg.incarnation)
+	data = appendString(data, e.msg.current)
+
+	var flags byte
+	if e.msg.left {
+		flags = 1
+	}
+	return append(data, flags)
+}
+
+func (d *messageDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errInvalidMessage
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *messageDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 1 {
+		d.err = errInvalidMessage
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *messageDecoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.data)) < n {
+		d.err = errInvalidMessage
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *messageDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < n {
+		d.err = errInvalidMessage
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *messageDecoder) partitionEntry() partitionEntry {
+	id := d.uvarint()
+	if id > math.MaxUint32 {
+		d.err = errInvalidMessage
+	}
+	incarnation := d.uvarint()
+	current := d.string()
+
+	flags := d.byte()
+	if flags > 1 {
+		d.err = errInvalidMessage
+	}
+
+	return partitionEntry{
+		id: PartitionID(id),
+		msg: partitionMsg{
+			incarnation: incarnation,
+			current:     current,
+			left:        flags == 1,
+		},
+	}
+}
+
+func (d *messageDecoder) finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) > 0 {
+		return errInvalidMessage
+	}
+	return nil
+}
+
+func marshalPartitionEntries(msgType messageType, entries []partitionEntry) []byte {
+	data := appendMessageHeader(nil, msgType)
+	data = appendUvarint(data, uint64(len(entries)))
+	for _, e := range entries {
+		data = appendPartitionEntry(data, e)
+	}
+	return data
+}
+
+func unmarshalPartitionEntries(expectedType messageType, data []byte) ([]partitionEntry, error) {
+	msgType, body, err := parseMessageHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != expectedType {
+		return nil, errInvalidMessage
+	}
+
+	d := &messageDecoder{data: body}
+	count := d.uvarint()
+	if count > uint64(len(d.data)) {
+		return nil, errInvalidMessage
+	}
+
+	result := make([]partitionEntry, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		result = append(result, d.partitionEntry())
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Marshal ...
+func (b partitionBatch) Marshal() []byte {
+	return marshalPartitionEntries(messageTypePartitions, b)
+}
+
+// Unmarshal ...
+func (b *partitionBatch) Unmarshal(data []byte) error {
+	entries, err := unmarshalPartitionEntries(messageTypePartitions, data)
+	if err != nil {
+		return err
+	}
+	*b = entries
+	return nil
+}
+
+// Marshal ...
+func (s partitionSnapshot) Marshal() []byte {
+	return marshalPartitionEntries(messageTypePartitionSnapshot, s)
+}
+
+// Unmarshal ...
+func (s *partitionSnapshot) Unmarshal(data []byte) error {
+	entries, err := unmarshalPartitionEntries(messageTypePartitionSnapshot, data)
+	if err != nil {
+		return err
+	}
+	*s = entries
+	return nil
+}
+
+// Marshal ...
+func (u unhealthyPartitions) Marshal() []byte {
+	return marshalPartitionEntries(messageTypeUnhealthyPartitions, u)
+}
+
+// Unmarshal sets the entries as left and unhealthy
+func (u *unhealthyPartitions) Unmarshal(data []byte) error {
+	entries, err := unmarshalPartitionEntries(messageTypeUnhealthyPartitions, data)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].msg.left = true
+		entries[i].msg.unhealthy = true
+	}
+	*u = entries
+	return nil
+}
+
+// Marshal ...
+func (m nodeLeftMsg) Marshal() []byte {
+	data := appendMessageHeader(nil, messageTypeNodeLeft)
+	data = appendString(data, m.name)
+	return appendString(data, m.addr)
+}
+
+// Unmarshal ...
+func (m *nodeLeftMsg) Unmarshal(data []byte) error {
+	msgType, body, err := parseMessageHeader(data)
+	if err != nil {
+		return err
+	}
+	if msgType != messageTypeNodeLeft {
+		return errInvalidMessage
+	}
+
+	d := &messageDecoder{data: body}
+	name := d.string()
+	addr := d.string()
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	m.name = name
+	m.addr = addr
+	return nil
+}
+
+// Marshal ...
+func (m nodeMeta) Marshal() []byte {
+	data := appendMessageHeader(nil, messageTypeNodeMeta)
+	data = appendUvarint(data, uint64(m.weight))
+
+	keys := make([]string, 0, len(m.labels))
+	for k := range m.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data = appendUvarint(data, uint64(len(keys)))
+	for _, k := range keys {
+		data = appendString(data, k)
+		data = appendString(data, m.labels[k])
+	}
+	return data
+}
+
+// Unmarshal ...
+func (m *nodeMeta) Unmarshal(data []byte) error {
+	msgType, body, err := parseMessageHeader(data)
+	if err != nil {
+		return err
+	}
+	if msgType != messageTypeNodeMeta {
+		return errInvalidMessage
+	}
+
+	d := &messageDecoder{data: body}
+	weight := d.uvarint()
+	if weight > math.MaxInt32 {
+		d.err = errInvalidMessage
+	}
+
+	count := d.uvarint()
+	if count > uint64(len(d.data)) {
+		return errInvalidMessage
+	}
+
+	var labels map[string]string
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		k := d.string()
+		labels[k] = d.string()
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	m.weight = int(weight)
+	m.labels = labels
+	return nil
+}
+
+// batchPartitionEntries packs the entries into as few messages as possible,
+// each message is no larger than maxSize unless a single entry already exceeds it
+func batchPartitionEntries(entries []partitionEntry, maxSize int) [][]byte {
+	return batchEntries(messageTypePartitions, entries, maxSize)
+}
+
+func batchEntries(msgType messageType, entries []partitionEntry, maxSize int) [][]byte {
+	var result [][]byte
+
+	var batch []byte
+	count := 0
+	size := messageHeaderSize + binary.MaxVarintLen64
+
+	var entryBuf []byte
+	for _, e := range entries {
+		entryBuf = appendPartitionEntry(entryBuf[:0], e)
+
+		if count > 0 && size+len(entryBuf) > maxSize {
+			result = append(result, finishBatch(msgType, batch, count))
+			batch = batch[:0:0]
+			count = 0
+			size = messageHeaderSize + binary.MaxVarintLen64
+		}
+
+		batch = append(batch, entryBuf...)
+		count++
+		size += len(entryBuf)
+	}
+
+	if count > 0 {
+		result = append(result, finishBatch(msgType, batch, count))
+	}
+	return result
+}
+
+func finishBatch(msgType messageType, entries []byte, count int) []byte {
+	data := appendMessageHeader(nil, msgType)
+	data = appendUvarint(data, uint64(count))
+	return append(data, entries...)
+}
+
+// sequencedPartitions is a partition batch numbered by its sender, receivers acknowledge it with partitionsAck
+type sequencedPartitions struct {
+	sender string
+	seq    uint64
+	batch  partitionBatch
+}
+
+// partitionsAck acknowledges the sequenced partitions received from a sender
+type partitionsAck struct {
+	from string
+	to   string
+	seqs []uint64
+}
+
+// marshalSequencedPartitions wraps a marshaled partition batch
+func marshalSequencedPartitions(sender string, seq uint64, batch []byte) []byte {
+	data := appendMessageHeader(nil, messageTypeSequencedPartitions)
+	data = appendString(data, sender)
+	data = appendUvarint(data, seq)
+	return appendBytes(data, batch)
+}
+
+// Unmarshal ...
+func (m *sequencedPartitions) Unmarshal(data []byte) error {
+	msgType, body, err := parseMessageHeader(data)
+	if err != nil {
+		return err
+	}
+	if msgType != messageTypeSequencedPartitions {
+		return errInvalidMessage
+	}
+
+	d := &messageDecoder{data: body}
+	sender := d.string()
+	seq := d.uvarint()
+	inner := d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	var batch partitionBatch
+	if err := batch.Unmarshal(inner); err != nil {
+		return err
+	}
+
+	m.sender = sender
+	m.seq = seq
+	m.batch = batch
+	return nil
+}
+
+// Marshal ...
+func (m partitionsAck) Marshal() []byte {
+	data := appendMessageHeader(nil, messageTypePartitionsAck)
+	data = appendString(data, m.from)
+	data = appendString(data, m.to)
+	data = appendUvarint(data, uint64(len(m.seqs)))
+	for _, seq := range m.seqs {
+		data = appendUvarint(data, seq)
+	}
+	return data
+}
+
+// Unmarshal ...
+func (m *partitionsAck) Unmarshal(data []byte) error {
+	msgType, body, err := parseMessageHeader(data)
+	if err != nil {
+		return err
+	}
+	if msgType != messageTypePartitionsAck {
+		return errInvalidMessage
+	}
+
+	d := &messageDecoder{data: body}
+	from := d.string()
+	to := d.string()
+
+	count := d.uvarint()
+	if count > uint64(len(d.data)) {
+		return errInvalidMessage
+	}
+	seqs := make([]uint64, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		seqs = append(seqs, d.uvarint())
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	m.from = from
+	m.to = to
+	m.seqs = seqs
+	return nil
+}
@@ -0,0 +1,239 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPartitionBatch_Marshal_Unmarshal(t *testing.T) {
+	batch := partitionBatch{
+		{id: 7, msg: partitionMsg{incarnation: 12, current: "node01", left: true}},
+		{id: 1023, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	}
+
+	data := batch.Marshal()
+	assert.Equal(t, messageVersion, data[0])
+	assert.Equal(t, byte(messageTypePartitions), data[1])
+
+	var result partitionBatch
+	err := result.Unmarshal(data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, batch, result)
+}
+
+func TestPartitionBatch_Marshal_Compact(t *testing.T) {
+	data := partitionBatch{
+		{id: 7, msg: partitionMsg{incarnation: 12, current: "node01"}},
+	}.Marshal()
+
+	assert.Equal(t, []byte{
+		messageVersion, byte(messageTypePartitions),
+		1, 7, 12, 6, 'n', 'o', 'd', 'e', '0', '1', 0,
+	}, data)
+}
+
+func TestPartitionBatch_Unmarshal_Invalid(t *testing.T) {
+	table := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "empty", data: nil, err: errInvalidMessage},
+		{name: "unsupported-version", data: []byte{2, byte(messageTypePartitions), 0}, err: errUnsupportedVersion},
+		{name: "wrong-type", data: nodeLeftMsg{name: "node01"}.Marshal(), err: errInvalidMessage},
+		{name: "missing-entries", data: []byte{messageVersion, byte(messageTypePartitions), 1}, err: errInvalidMessage},
+		{name: "string-too-long", data: []byte{messageVersion, byte(messageTypePartitions), 1, 1, 1, 10, 'a', 0}, err: errInvalidMessage},
+		{name: "invalid-flags", data: []byte{messageVersion, byte(messageTypePartitions), 1, 1, 1, 0, 2}, err: errInvalidMessage},
+		{name: "trailing-data", data: []byte{messageVersion, byte(messageTypePartitions), 1, 1, 1, 0, 0, 5}, err: errInvalidMessage},
+		{
+			name: "partition-id-overflow",
+			data: []byte{messageVersion, byte(messageTypePartitions), 1, 0x80, 0x80, 0x80, 0x80, 0x10, 1, 0, 0},
+			err:  errInvalidMessage,
+		},
+	}
+
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			var batch partitionBatch
+			err := batch.Unmarshal(e.data)
+			assert.Equal(t, e.err, err)
+		})
+	}
+}
+
+func TestNodeLeftMsg_Marshal_Unmarshal(t *testing.T) {
+	msg := nodeLeftMsg{
+		name: "node01",
+		addr: "127.0.0.1:7000",
+	}
+
+	var result nodeLeftMsg
+	err := result.Unmarshal(msg.Marshal())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, msg, result)
+}
+
+func TestNodeLeftMsg_Unmarshal_Invalid(t *testing.T) {
+	var msg nodeLeftMsg
+
+	err := msg.Unmarshal([]byte{messageVersion, byte(messageTypeNodeLeft), 10, 'a'})
+	assert.Equal(t, errInvalidMessage, err)
+
+	err = msg.Unmarshal(partitionBatch{}.Marshal())
+	assert.Equal(t, errInvalidMessage, err)
+}
+
+func TestUnhealthyPartitions_Marshal_Unmarshal(t *testing.T) {
+	data := unhealthyPartitions{
+		{id: 8, msg: partitionMsg{incarnation: 3, current: "node03", left: true, unhealthy: true}},
+	}.Marshal()
+	assert.Equal(t, byte(messageTypeUnhealthyPartitions), data[1])
+
+	var result unhealthyPartitions
+	assert.Equal(t, nil, result.Unmarshal(data))
+	assert.Equal(t, unhealthyPartitions{
+		{id: 8, msg: partitionMsg{incarnation: 3, current: "node03", left: true, unhealthy: true}},
+	}, result)
+
+	// the entries are encoded as in partition batches, which older nodes decode
+	var batch partitionBatch
+	assert.Equal(t, errInvalidMessage, batch.Unmarshal(data))
+}
+
+func TestBatchPartitionEntries(t *testing.T) {
+	entries := make([]partitionEntry, 0, 1024)
+	for i := 0; i < 1024; i++ {
+		entries = append(entries, partitionEntry{
+			id:  PartitionID(i),
+			msg: partitionMsg{incarnation: 5, current: "node01", left: true},
+		})
+	}
+
+	packets := batchPartitionEntries(entries, 1024)
+	assert.Equal(t, 12, len(packets))
+
+	var result []partitionEntry
+	for _, data := range packets {
+		assert.LessOrEqual(t, len(data), 1024)
+
+		var batch partitionBatch
+		err := batch.Unmarshal(data)
+		assert.Equal(t, nil, err)
+		result = append(result, batch...)
+	}
+	assert.Equal(t, entries, result)
+}
+
+func TestBatchPartitionEntries_Entry_Larger_Than_Max_Size(t *testing.T) {
+	packets := batchPartitionEntries([]partitionEntry{
+		{id: 1, msg: partitionMsg{current: "node01"}},
+		{id: 2, msg: partitionMsg{current: "node02"}},
+	}, 4)
+	assert.Equal(t, 2, len(packets))
+}
+
+func TestBatchPartitionEntries_Empty(t *testing.T) {
+	assert.Equal(t, [][]byte(nil), batchPartitionEntries(nil, 1024))
+}
+
+func FuzzPartitionBatch_Unmarshal(f *testing.F) {
+	f.Add(partitionBatch{
+		{id: 7, msg: partitionMsg{incarnation: 12, current: "node01", left: true}},
+	}.Marshal())
+	f.Add([]byte{messageVersion, byte(messageTypePartitions), 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var batch partitionBatch
+		if err := batch.Unmarshal(data); err != nil {
+			return
+		}
+
+		var result partitionBatch
+		err := result.Unmarshal(batch.Marshal())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, batch, result)
+	})
+}
+
+func FuzzNodeLeftMsg_Unmarshal(f *testing.F) {
+	f.Add(nodeLeftMsg{name: "node01", addr: "127.0.0.1:7000"}.Marshal())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg nodeLeftMsg
+		if err := msg.Unmarshal(data); err != nil {
+			return
+		}
+
+		var result nodeLeftMsg
+		err := result.Unmarshal(msg.Marshal())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, msg, result)
+	})
+}
+
+func TestPartitionSnapshot_Marshal_Unmarshal(t *testing.T) {
+	snapshot := partitionSnapshot{
+		{id: 0, msg: partitionMsg{incarnation: 3, current: "node01"}},
+		{id: 5, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	}
+
+	data := snapshot.Marshal()
+	assert.Equal(t, byte(messageTypePartitionSnapshot), data[1])
+
+	var result partitionSnapshot
+	err := result.Unmarshal(data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, snapshot, result)
+
+	var batch partitionBatch
+	err = batch.Unmarshal(data)
+	assert.Equal(t, errInvalidMessage, err)
+}
+
+func TestNodeMeta_Marshal_Unmarshal(t *testing.T) {
+	var meta nodeMeta
+	err := meta.Unmarshal(nodeMeta{weight: 8}.Marshal())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nodeMeta{weight: 8}, meta)
+
+	err = meta.Unmarshal(partitionBatch{}.Marshal())
+	assert.Equal(t, errInvalidMessage, err)
+}
+
+func TestNodeMeta_Marshal_Unmarshal_Labels(t *testing.T) {
+	input := nodeMeta{
+		weight: 2,
+		labels: map[string]string{LabelZone: "zone-1", LabelRack: "rack-2"},
+	}
+
+	var meta nodeMeta
+	err := meta.Unmarshal(input.Marshal())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, input, meta)
+	assert.Equal(t, input.Marshal(), meta.Marshal())
+}
+
+func TestSequencedPartitions_Marshal_Unmarshal(t *testing.T) {
+	batch := partitionBatch{
+		{id: 3, msg: partitionMsg{incarnation: 2, current: "node01", left: true}},
+	}
+	data := marshalSequencedPartitions("node01", 300, batch.Marshal())
+
+	var msg sequencedPartitions
+	assert.Equal(t, nil, msg.Unmarshal(data))
+	assert.Equal(t, sequencedPartitions{sender: "node01", seq: 300, batch: batch}, msg)
+
+	assert.Equal(t, errInvalidMessage, msg.Unmarshal(data[:len(data)-1]))
+	assert.Equal(t, errInvalidMessage, msg.Unmarshal(batch.Marshal()))
+}
+
+func TestPartitionsAck_Marshal_Unmarshal(t *testing.T) {
+	ack := partitionsAck{from: "node02", to: "node01", seqs: []uint64{1, 200, 3}}
+
+	var result partitionsAck
+	assert.Equal(t, nil, result.Unmarshal(ack.Marshal()))
+	assert.Equal(t, ack, result)
+
+	data := ack.Marshal()
+	assert.Equal(t, errInvalidMessage, result.Unmarshal(data[:len(data)-1]))
+}
@@ -0,0 +1,55 @@
+package shim
+
+import "sort"
+
+// limitMigrations keeps at most migrationLimit partitions of each holder moving to other nodes,
+// the other moves are postponed by keeping their holders as owners until a slot is released.
+// The moves are chosen by partition id so that all nodes with the same view agree on them,
+// except that the partitions this node is already stopping keep their slots
+func (s *coreService) limitMigrations(owners []string, nodeSet map[string]struct{}) {
+	limit := s.options.migrationLimit
+	if limit <= 0 {
+		return
+	}
+
+	s.stats.PendingMigrations = 0
+	moving := map[string][]PartitionID{}
+	for i := range s.partitions {
+		holder := s.partitions[i].state.holder()
+		if _, existed := nodeSet[holder]; !existed {
+			continue
+		}
+		if owners[i] == "" || owners[i] == holder {
+			continue
+		}
+		moving[holder] = append(moving[holder], PartitionID(i))
+	}
+
+	for holder, ids := range moving {
+		if len(ids) <= limit {
+			continue
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			return s.isMigrating(ids[i]) && !s.isMigrating(ids[j])
+		})
+		for _, id := range ids[limit:] {
+			owners[id] = holder
+		}
+		s.stats.PendingMigrations += len(ids) - limit
+	}
+}
+
+func (s *coreService) isMigrating(id PartitionID) bool {
+	return s.partitions[id].state.status == partitionStatusStopping
+}
+
+// migrationReleased starts the postponed migrations after a partition of this node was released
+func (s *coreService) migrationReleased(id PartitionID, prevHolder string) {
+	if s.options.migrationLimit <= 0 {
+		return
+	}
+	if s.partitions[id].state.holder() == prevHolder {
+		return
+	}
+	s.reallocate()
+}
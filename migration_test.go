@@ -0,0 +1,79 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newMigrationTest(limit int) *coreServiceTest {
+	c := newCoreServiceTest(6, WithMigrationLimit(limit))
+
+	c.core.onJoinCompleted()
+	for i := 0; i < 6; i++ {
+		c.startCompleted[PartitionID(i)]()
+	}
+	return c
+}
+
+func TestCoreService_Migration_Limit__Stop_One_At_A_Time(t *testing.T) {
+	c := newMigrationTest(1)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+		{name: "node03", addr: "address03"},
+	})
+
+	assert.Equal(t, []PartitionID{2}, c.stoppedPartitions())
+	assert.Equal(t, "node01", c.core.partitions[3].state.owner)
+	assert.Equal(t, 3, c.core.getStats().PendingMigrations)
+
+	c.stopCompleted[2]()
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+	assert.Equal(t, 2, c.core.getStats().PendingMigrations)
+
+	c.stopCompleted[3]()
+	c.stopCompleted[4]()
+	c.stopCompleted[5]()
+
+	assert.Equal(t, []PartitionID{2, 3, 4, 5}, c.stoppedPartitions())
+	assert.Equal(t, 0, c.core.getStats().PendingMigrations)
+	assert.Equal(t, "node02", c.core.partitions[2].state.owner)
+	assert.Equal(t, "node02", c.core.partitions[3].state.owner)
+	assert.Equal(t, "node03", c.core.partitions[4].state.owner)
+	assert.Equal(t, "node03", c.core.partitions[5].state.owner)
+}
+
+func TestCoreService_Migration_Limit__Stopping_Keep_Their_Slots(t *testing.T) {
+	c := newMigrationTest(2)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+		{name: "node03", addr: "address03"},
+	})
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+		{name: "node03", addr: "address03"},
+		{name: "node04", addr: "address04"},
+	})
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+	assert.Equal(t, partitionStatusStopping, c.core.partitions[2].state.status)
+	assert.Equal(t, partitionStatusStopping, c.core.partitions[3].state.status)
+}
+
+func TestCoreService_Migration_Limit__Not_Applied_To_Partitions_Without_Holder(t *testing.T) {
+	c := newCoreServiceTest(4, WithMigrationLimit(1))
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.onJoinCompleted()
+
+	assert.Equal(t, 2, len(c.runner.StartCalls()))
+	assert.Equal(t, 0, c.core.getStats().PendingMigrations)
+}
@@ -11,6 +11,9 @@ type nodeStatus int
 const (
 	nodeStatusAlive nodeStatus = iota
 	nodeStatusGracefulLeft
+
+	// nodeStatusLeaving is a member that announced its graceful leave and is draining its partitions
+	nodeStatusLeaving
 )
 
 type nodeLeftMsg struct {
@@ -21,6 +24,7 @@ type nodeLeftMsg struct {
 type nodeState struct {
 	status nodeStatus
 	addr   string
+	meta   nodeMeta
 	leftAt time.Time
 }
 
@@ -29,40 +33,51 @@ type nodeJoinManager struct {
 
 	listener           nodeListener
 	broadcaster        nodeBroadcaster
+	events             *eventDispatcher
 	gracefulLeftExpire time.Duration
 
-	knownAddrs []string
+	knownAddrs  []string
+	staticAddrs []string
 
 	selfNode string
 	selfAddr string
+	selfMeta nodeMeta
 
 	joining bool
 	version uint64
 	nodes   map[string]nodeState
 
+	// reported is the set of alive nodes last passed to the listener
+	reported map[string]struct{}
+
 	getNow func() time.Time
 }
 
 func newNodeJoinManager(
 	selfNode string, selfAddr string,
 	listener nodeListener, broadcaster nodeBroadcaster,
-	opts serviceOptions,
+	events *eventDispatcher, opts serviceOptions,
 ) *nodeJoinManager {
 	return &nodeJoinManager{
 		listener:           listener,
 		broadcaster:        broadcaster,
+		events:             events,
 		gracefulLeftExpire: 30 * time.Second,
 
-		knownAddrs: removeSelfAddrInConfiguredStaticAddrs(opts.staticAddrs, selfAddr),
+		knownAddrs:  removeSelfAddrInConfiguredStaticAddrs(opts.staticAddrs, selfAddr),
+		staticAddrs: removeSelfAddrInConfiguredStaticAddrs(opts.staticAddrs, selfAddr),
 
 		selfNode: selfNode,
 		selfAddr: selfAddr,
+		selfMeta: opts.nodeMeta(),
 
 		joining: false,
 		version: 0,
 		nodes:   map[string]nodeState{},
 
-		getNow: func() time.Time { return time.Now() },
+		reported: map[string]struct{}{},
+
+		getNow: opts.clock.Now,
 	}
 }
 
@@ -97,29 +112,64 @@ func (m *nodeJoinManager) callOnChange() {
 	nodes = append(nodes, nodeInfo{
 		name: m.selfNode,
 		addr: m.selfAddr,
+		meta: m.selfMeta,
 	})
 	for nodeName, n := range m.nodes {
-		if n.status != nodeStatusAlive {
+		if n.status == nodeStatusGracefulLeft {
 			continue
 		}
 
 		nodes = append(nodes, nodeInfo{
-			name: nodeName,
-			addr: n.addr,
+			name:    nodeName,
+			addr:    n.addr,
+			meta:    n.meta,
+			leaving: n.status == nodeStatusLeaving,
 		})
 	}
 	sort.Slice(nodes, func(i, j int) bool {
 		return nodes[i].name < nodes[j].name
 	})
+
+	m.publishNodeEvents(nodes)
 	m.listener.onChange(nodes)
 }
 
-func (m *nodeJoinManager) notifyJoin(name string, addr string) {
+func (m *nodeJoinManager) publishNodeEvents(nodes []nodeInfo) {
+	alive := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		if n.name == m.selfNode || n.leaving {
+			continue
+		}
+		alive[n.name] = struct{}{}
+		if _, existed := m.reported[n.name]; !existed {
+			m.events.publish(Event{Type: EventNodeJoined, Node: n.name})
+		}
+	}
+
+	var left []string
+	for name := range m.reported {
+		if _, existed := alive[name]; !existed {
+			left = append(left, name)
+		}
+	}
+	sort.Strings(left)
+
+	for _, name := range left {
+		eventType := EventNodeLeft
+		if m.nodes[name].status != nodeStatusAlive {
+			eventType = EventNodeGracefullyLeft
+		}
+		m.events.publish(Event{Type: eventType, Node: name})
+	}
+	m.reported = alive
+}
+
+func (m *nodeJoinManager) notifyJoin(name string, addr string, meta nodeMeta) {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 
 	m.version++
-	m.nodes = nodeJoin(m.nodes, name, addr, m.knownAddrs, m.getNow(), m.gracefulLeftExpire)
+	m.nodes = nodeJoin(m.nodes, name, addr, meta, m.knownAddrs, m.getNow(), m.gracefulLeftExpire)
 
 	m.callOnChange()
 }
@@ -142,10 +192,51 @@ func (m *nodeJoinManager) joinCompleted() {
 	m.listener.onJoinCompleted()
 }
 
+// setDiscoveredAddrs replaces the discovered addresses, the known addresses are them and the static addresses.
+// It returns true when the known addresses changed
+func (m *nodeJoinManager) setDiscoveredAddrs(addrs []string) bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	known := append([]string(nil), m.staticAddrs...)
+	known = append(known, removeSelfAddrInConfiguredStaticAddrs(addrs, m.selfAddr)...)
+	known = sortAddrs(known)
+
+	if equalAddrs(known, m.knownAddrs) {
+		return false
+	}
+	m.knownAddrs = known
+	return true
+}
+
+func equalAddrs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// changedSince returns true when the members changed after needJoin returned the version
+func (m *nodeJoinManager) changedSince(version uint64) bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	return m.version != version
+}
+
 func (m *nodeJoinManager) notifyMsg(msg nodeLeftMsg) {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 
+	if msg.name == m.selfNode {
+		return
+	}
+
 	m.version++
 
 	var changed bool
@@ -171,6 +262,7 @@ func removeSelfAddrInConfiguredStaticAddrs(configured []string, selfAddr string)
 type addressNodeState struct {
 	name   string
 	status nodeStatus
+	meta   nodeMeta
 	leftAt time.Time
 }
 
@@ -219,6 +311,7 @@ func computeKeptNodes(
 		addressMap[n.addr] = append(addressMap[n.addr], addressNodeState{
 			name:   key,
 			status: n.status,
+			meta:   n.meta,
 			leftAt: n.leftAt,
 		})
 	}
@@ -240,6 +333,7 @@ func computeKeptNodes(
 			result[n.name] = nodeState{
 				status: n.status,
 				addr:   addr,
+				meta:   n.meta,
 				leftAt: n.leftAt,
 			}
 		}
@@ -256,13 +350,19 @@ func cloneNodeStates(input map[string]nodeState) map[string]nodeState {
 }
 
 func nodeJoin(
-	inputNodes map[string]nodeState, name string, addr string,
+	inputNodes map[string]nodeState, name string, addr string, meta nodeMeta,
 	configured []string, now time.Time, expire time.Duration,
 ) map[string]nodeState {
 	nodes := cloneNodeStates(inputNodes)
+
+	status := nodeStatusAlive
+	if prev, ok := nodes[name]; ok && prev.status == nodeStatusLeaving {
+		status = nodeStatusLeaving
+	}
 	nodes[name] = nodeState{
-		status: nodeStatusAlive,
+		status: status,
 		addr:   addr,
+		meta:   meta,
 	}
 
 	return computeKeptNodes(nodes, configured, now, expire)
@@ -275,10 +375,20 @@ func nodeGracefulLeave(
 	nodes := cloneNodeStates(inputNodes)
 
 	prev, ok := nodes[name]
-	if ok && prev.status == nodeStatusGracefulLeft {
+	if ok && prev.status != nodeStatusAlive {
 		return computeKeptNodes(nodes, configured, now, expire), false
 	}
 
+	// a member stays in the cluster while draining its partitions, until the membership layer removes it
+	if ok {
+		nodes[name] = nodeState{
+			status: nodeStatusLeaving,
+			addr:   prev.addr,
+			meta:   prev.meta,
+		}
+		return computeKeptNodes(nodes, configured, now, expire), true
+	}
+
 	nodes[name] = nodeState{
 		status: nodeStatusGracefulLeft,
 		addr:   addr,
@@ -296,5 +406,12 @@ func nodeLeave(
 	if ok && node.status == nodeStatusAlive {
 		delete(nodes, name)
 	}
+	if ok && node.status == nodeStatusLeaving {
+		nodes[name] = nodeState{
+			status: nodeStatusGracefulLeft,
+			addr:   node.addr,
+			leftAt: now,
+		}
+	}
 	return computeKeptNodes(nodes, configured, now, expire)
 }
@@ -8,7 +8,7 @@ import (
 
 func TestNodeJoinManager_WithStaticAddrs(t *testing.T) {
 	m := newNodeJoinManager(
-		"self-node", "address01", nil, nil,
+		"self-node", "address01", nil, nil, nil,
 		computeOptions(WithStaticAddresses([]string{"address01", "address02", "address03"})),
 	)
 
@@ -19,7 +19,7 @@ func TestNodeJoinManager_WithStaticAddrs(t *testing.T) {
 
 func TestNodeJoinManager_WithStaticAddrs_Itself(t *testing.T) {
 	m := newNodeJoinManager(
-		"self-node", "address01", nil, nil,
+		"self-node", "address01", nil, nil, nil,
 		computeOptions(WithStaticAddresses([]string{"address01"})),
 	)
 
@@ -30,7 +30,7 @@ func TestNodeJoinManager_WithStaticAddrs_Itself(t *testing.T) {
 
 func TestNodeJoinManager_WithNoStaticAddrs(t *testing.T) {
 	m := newNodeJoinManager(
-		"self-node", "address01", nil, nil,
+		"self-node", "address01", nil, nil, nil,
 		computeOptions(WithStaticAddresses(nil)),
 	)
 
@@ -42,7 +42,7 @@ func TestNodeJoinManager_WithNoStaticAddrs(t *testing.T) {
 func TestNodeJoinManager_Join_Completed_All_Nodes(t *testing.T) {
 	listener := &nodeListenerMock{}
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, nil,
+		"self-node", "address01", listener, nil, nil,
 		computeOptions(WithStaticAddresses([]string{"address02", "address03"})),
 	)
 
@@ -52,7 +52,7 @@ func TestNodeJoinManager_Join_Completed_All_Nodes(t *testing.T) {
 
 	var listenNodes []nodeInfo
 	listener.onChangeFunc = func(nodes []nodeInfo) { listenNodes = nodes }
-	m.notifyJoin("other02", "address02")
+	m.notifyJoin("other02", "address02", nodeMeta{})
 
 	assert.Equal(t, 1, len(listener.onChangeCalls()))
 	assert.Equal(t, []nodeInfo{
@@ -64,7 +64,7 @@ func TestNodeJoinManager_Join_Completed_All_Nodes(t *testing.T) {
 	assert.Equal(t, []string(nil), joinAddrs)
 	assert.Equal(t, uint64(1), version)
 
-	m.notifyJoin("other01", "address03")
+	m.notifyJoin("other01", "address03", nodeMeta{})
 
 	assert.Equal(t, 2, len(listener.onChangeCalls()))
 	assert.Equal(t, []nodeInfo{
@@ -86,7 +86,7 @@ func TestNodeJoinManager_Join_Completed_All_Nodes(t *testing.T) {
 func TestNodeJoinManager_Join_Completed_Missing_Node(t *testing.T) {
 	listener := &nodeListenerMock{}
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, nil,
+		"self-node", "address01", listener, nil, nil,
 		computeOptions(WithStaticAddresses([]string{"address03", "address02"})),
 	)
 
@@ -96,7 +96,7 @@ func TestNodeJoinManager_Join_Completed_Missing_Node(t *testing.T) {
 
 	var listenNodes []nodeInfo
 	listener.onChangeFunc = func(nodes []nodeInfo) { listenNodes = nodes }
-	m.notifyJoin("other01", "address02")
+	m.notifyJoin("other01", "address02", nodeMeta{})
 
 	assert.Equal(t, []nodeInfo{
 		{name: "other01", addr: "address02"},
@@ -122,7 +122,7 @@ func TestNodeJoinManager_Notify_Left_Msg(t *testing.T) {
 	broadcast := &nodeBroadcasterMock{}
 
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, broadcast,
+		"self-node", "address01", listener, broadcast, nil,
 		computeOptions(WithStaticAddresses([]string{"address03", "address02"})),
 	)
 
@@ -130,8 +130,8 @@ func TestNodeJoinManager_Notify_Left_Msg(t *testing.T) {
 
 	listener.onChangeFunc = func(nodes []nodeInfo) {}
 
-	m.notifyJoin("other01", "address02")
-	m.notifyJoin("other02", "address03")
+	m.notifyJoin("other01", "address02", nodeMeta{})
+	m.notifyJoin("other02", "address03", nodeMeta{})
 
 	listener.onJoinCompletedFunc = func() {}
 	m.joinCompleted()
@@ -152,6 +152,7 @@ func TestNodeJoinManager_Notify_Left_Msg(t *testing.T) {
 
 	assert.Equal(t, 3, len(listener.onChangeCalls()))
 	assert.Equal(t, []nodeInfo{
+		{name: "other01", addr: "address02", leaving: true},
 		{name: "other02", addr: "address03"},
 		{name: "self-node", addr: "address01"},
 	}, changeNodes)
@@ -161,6 +162,13 @@ func TestNodeJoinManager_Notify_Left_Msg(t *testing.T) {
 	assert.Equal(t, []string(nil), joinAddrs)
 
 	assert.Equal(t, 1, len(broadcast.broadcastCalls()))
+
+	m.notifyLeave("other01")
+	assert.Equal(t, 4, len(listener.onChangeCalls()))
+	assert.Equal(t, []nodeInfo{
+		{name: "other02", addr: "address03"},
+		{name: "self-node", addr: "address01"},
+	}, changeNodes)
 	assert.Equal(t, nodeLeftMsg{
 		name: "other01",
 		addr: "address02",
@@ -172,7 +180,7 @@ func TestNodeJoinManager_Notify_Left_Msg_Second_Time(t *testing.T) {
 	broadcast := &nodeBroadcasterMock{}
 
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, broadcast,
+		"self-node", "address01", listener, broadcast, nil,
 		computeOptions(WithStaticAddresses([]string{"address03", "address02"})),
 	)
 
@@ -180,8 +188,8 @@ func TestNodeJoinManager_Notify_Left_Msg_Second_Time(t *testing.T) {
 
 	listener.onChangeFunc = func(nodes []nodeInfo) {}
 
-	m.notifyJoin("other01", "address02")
-	m.notifyJoin("other02", "address03")
+	m.notifyJoin("other01", "address02", nodeMeta{})
+	m.notifyJoin("other02", "address03", nodeMeta{})
 
 	listener.onJoinCompletedFunc = func() {}
 	m.joinCompleted()
@@ -212,7 +220,7 @@ func TestNodeJoinManager_Notify_Left_Msg_Second_Time(t *testing.T) {
 func TestNodeJoinManager_Node_Leave(t *testing.T) {
 	listener := &nodeListenerMock{}
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, nil,
+		"self-node", "address01", listener, nil, nil,
 		computeOptions(WithStaticAddresses([]string{"address03", "address02"})),
 	)
 
@@ -223,8 +231,8 @@ func TestNodeJoinManager_Node_Leave(t *testing.T) {
 		changeNodes = nodes
 	}
 
-	m.notifyJoin("other01", "address02")
-	m.notifyJoin("other02", "address03")
+	m.notifyJoin("other01", "address02", nodeMeta{})
+	m.notifyJoin("other02", "address03", nodeMeta{})
 
 	listener.onJoinCompletedFunc = func() {}
 	m.joinCompleted()
@@ -246,7 +254,7 @@ func TestNodeJoinManager_Notify_Left_Msg_And_Then_Leave__No_Need_Join(t *testing
 	listener := &nodeListenerMock{}
 	broadcaster := &nodeBroadcasterMock{}
 	m := newNodeJoinManager(
-		"self-node", "address01", listener, broadcaster,
+		"self-node", "address01", listener, broadcaster, nil,
 		computeOptions(WithStaticAddresses([]string{"address03", "address02"})),
 	)
 
@@ -254,8 +262,8 @@ func TestNodeJoinManager_Notify_Left_Msg_And_Then_Leave__No_Need_Join(t *testing
 
 	listener.onChangeFunc = func(nodes []nodeInfo) {}
 
-	m.notifyJoin("other01", "address02")
-	m.notifyJoin("other02", "address03")
+	m.notifyJoin("other01", "address02", nodeMeta{})
+	m.notifyJoin("other02", "address03", nodeMeta{})
 
 	listener.onJoinCompletedFunc = func() {}
 	m.joinCompleted()
@@ -307,7 +315,7 @@ func mustParse(s string) time.Time {
 
 func TestNodeJoin(t *testing.T) {
 	t.Run("from-empty", func(t *testing.T) {
-		result := nodeJoin(nil, "node01", "address01",
+		result := nodeJoin(nil, "node01", "address01", nodeMeta{},
 			nil, mustParse("2021-07-26T10:00:00+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -326,7 +334,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node02", "address02",
+		result := nodeJoin(nodes, "node02", "address02", nodeMeta{},
 			nil, mustParse("2021-07-26T10:00:00+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -362,7 +370,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address02",
+		result := nodeJoin(nodes, "node03", "address02", nodeMeta{},
 			[]string{"address01", "address02"},
 			mustParse("2021-07-26T10:00:29+07:00"), 30*time.Second)
 
@@ -398,7 +406,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address02",
+		result := nodeJoin(nodes, "node03", "address02", nodeMeta{},
 			[]string{"address01", "address02"},
 			mustParse("2021-07-26T10:00:30+07:00"), 30*time.Second)
 
@@ -428,7 +436,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address02",
+		result := nodeJoin(nodes, "node03", "address02", nodeMeta{},
 			[]string{"address01", "address02"},
 			mustParse("2021-07-26T10:00:40+07:00"), 30*time.Second)
 
@@ -459,7 +467,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address02",
+		result := nodeJoin(nodes, "node03", "address02", nodeMeta{},
 			nil, mustParse("2021-07-26T10:00:27+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -493,7 +501,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address02",
+		result := nodeJoin(nodes, "node03", "address02", nodeMeta{},
 			nil, mustParse("2021-07-26T10:00:31+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -517,7 +525,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address01",
+		result := nodeJoin(nodes, "node03", "address01", nodeMeta{},
 			[]string{"address01"}, mustParse("2021-07-26T10:00:29+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -552,7 +560,7 @@ func TestNodeJoin(t *testing.T) {
 			},
 		}
 
-		result := nodeJoin(nodes, "node03", "address01",
+		result := nodeJoin(nodes, "node03", "address01", nodeMeta{},
 			[]string{"address01"}, mustParse("2021-07-26T10:00:31+07:00"), 30*time.Second)
 
 		assert.Equal(t, map[string]nodeState{
@@ -591,9 +599,8 @@ func TestNodeGracefulLeave(t *testing.T) {
 
 		assert.Equal(t, map[string]nodeState{
 			"node01": {
-				status: nodeStatusGracefulLeft,
+				status: nodeStatusLeaving,
 				addr:   "address01",
-				leftAt: mustParse("2021-07-26T10:00:00+07:00"),
 			},
 		}, result)
 		assert.Equal(t, true, changed)
@@ -611,9 +618,8 @@ func TestNodeGracefulLeave(t *testing.T) {
 
 		assert.Equal(t, map[string]nodeState{
 			"node01": {
-				status: nodeStatusGracefulLeft,
+				status: nodeStatusLeaving,
 				addr:   "address01",
-				leftAt: mustParse("2021-07-26T10:00:00+07:00"),
 			},
 		}, result)
 		assert.Equal(t, true, changed)
@@ -826,3 +832,38 @@ func TestCompressNodeStates(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeLeave_Leaving_Node__Graceful_Left(t *testing.T) {
+	nodes := map[string]nodeState{
+		"node01": {
+			status: nodeStatusLeaving,
+			addr:   "address01",
+		},
+	}
+	result := nodeLeave(nodes, "node01", nil, mustParse("2021-07-26T10:00:00+07:00"), 30*time.Second)
+
+	assert.Equal(t, map[string]nodeState{
+		"node01": {
+			status: nodeStatusGracefulLeft,
+			addr:   "address01",
+			leftAt: mustParse("2021-07-26T10:00:00+07:00"),
+		},
+	}, result)
+
+	result = nodeJoin(nodes, "node01", "address01", nodeMeta{weight: 2}, nil,
+		mustParse("2021-07-26T10:00:00+07:00"), 30*time.Second)
+	assert.Equal(t, map[string]nodeState{
+		"node01": {
+			status: nodeStatusLeaving,
+			addr:   "address01",
+			meta:   nodeMeta{weight: 2},
+		},
+	}, result)
+}
+
+func TestNodeJoinManager_Left_Msg_Of_Self__Ignored(t *testing.T) {
+	m := newNodeJoinManager("self-node", "address01", nil, nil, nil, computeOptions())
+	m.notifyMsg(nodeLeftMsg{name: "self-node", addr: "address01"})
+
+	assert.Equal(t, map[string]nodeState{}, m.nodes)
+}
@@ -1,14 +1,81 @@
 package shim
 
+import (
+	"net"
+	"time"
+)
+
 type serviceOptions struct {
-	staticAddrs []string
+	staticAddrs    []string
+	nodeDelegate   NodeDelegate
+	maxMessageSize int
+	clock          Clock
+	weight         int
+	labels         map[string]string
+	allocator      Allocator
+	standbyCount   int
+
+	retryMinDelay time.Duration
+	retryMaxDelay time.Duration
+
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	stuckPolicy  StuckPolicy
+	crashHandler func(partition PartitionID, op Operation)
+
+	keyHash func(key []byte) uint64
+
+	handoffTimeout time.Duration
+	migrationLimit int
+
+	settleDelay       time.Duration
+	reservationPeriod time.Duration
+
+	rejoinInterval time.Duration
+	joinMinDelay   time.Duration
+	joinMaxDelay   time.Duration
+
+	dnsDiscovery       *dnsDiscovery
+	dnsRefreshInterval time.Duration
+	resolver           Resolver
+
+	ackInterval   time.Duration
+	ackWindowSize int
+
+	checkpointStore CheckpointStore
+}
+
+func (o serviceOptions) nodeMeta() nodeMeta {
+	return nodeMeta{
+		weight: o.weight,
+		labels: o.labels,
+	}
 }
 
 // Option ...
 type Option func(opts *serviceOptions)
 
 func computeOptions(opts ...Option) serviceOptions {
-	result := serviceOptions{}
+	result := serviceOptions{
+		maxMessageSize: 1024,
+		clock:          systemClock{},
+		allocator:      NewStickyAllocator(),
+
+		retryMinDelay: 100 * time.Millisecond,
+		retryMaxDelay: 30 * time.Second,
+
+		crashHandler: defaultCrashHandler,
+
+		keyHash: fnvKeyHash,
+
+		rejoinInterval: 30 * time.Second,
+		joinMinDelay:   500 * time.Millisecond,
+		joinMaxDelay:   30 * time.Second,
+
+		resolver: net.DefaultResolver,
+
+		ackWindowSize: 1024,
+	}
 	for _, o := range opts {
 		o(&result)
 	}
@@ -21,3 +88,190 @@ func WithStaticAddresses(addrs []string) Option {
 		opts.staticAddrs = addrs
 	}
 }
+
+// WithNodeDelegate ...
+func WithNodeDelegate(delegate NodeDelegate) Option {
+	return func(opts *serviceOptions) {
+		opts.nodeDelegate = delegate
+	}
+}
+
+// WithMaxMessageSize limits the size of a broadcast message, partition messages are batched up to this size
+func WithMaxMessageSize(size int) Option {
+	return func(opts *serviceOptions) {
+		opts.maxMessageSize = size
+	}
+}
+
+// WithClock replaces the system clock, used for deterministic testing
+func WithClock(clock Clock) Option {
+	return func(opts *serviceOptions) {
+		opts.clock = clock
+	}
+}
+
+// WithNodeWeight sets the weight of the node, partitions are allocated to nodes proportionally to their weights.
+// The default weight is 1
+func WithNodeWeight(weight int) Option {
+	return func(opts *serviceOptions) {
+		opts.weight = weight
+	}
+}
+
+// WithAllocator replaces the default sticky allocator
+func WithAllocator(allocator Allocator) Option {
+	return func(opts *serviceOptions) {
+		opts.allocator = allocator
+	}
+}
+
+// WithNodeLabels sets the labels advertised by the node, e.g. its zone, rack and host
+func WithNodeLabels(labels map[string]string) Option {
+	return func(opts *serviceOptions) {
+		opts.labels = labels
+	}
+}
+
+// WithStandbyCount sets the number of standbys of each partition,
+// it only takes effect when the runner implements ReplicaRunner
+func WithStandbyCount(count int) Option {
+	return func(opts *serviceOptions) {
+		opts.standbyCount = count
+	}
+}
+
+// WithRetryBackoff sets the delays before retrying a failed start or stop of a partition,
+// the delay starts at minDelay and doubles for each consecutive failure up to maxDelay
+func WithRetryBackoff(minDelay time.Duration, maxDelay time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.retryMinDelay = minDelay
+		opts.retryMaxDelay = maxDelay
+	}
+}
+
+// WithOperationTimeouts sets the deadlines of starting and stopping a partition, zero means no deadline.
+// What happens to a stuck operation is decided by the stuck policy
+func WithOperationTimeouts(startTimeout time.Duration, stopTimeout time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.startTimeout = startTimeout
+		opts.stopTimeout = stopTimeout
+	}
+}
+
+// WithStuckPolicy sets the policy applied to operations exceeding their deadlines
+func WithStuckPolicy(policy StuckPolicy) Option {
+	return func(opts *serviceOptions) {
+		opts.stuckPolicy = policy
+	}
+}
+
+// WithCrashHandler replaces the handler called by StuckPolicyCrash, e.g. to log and exit the process
+func WithCrashHandler(handler func(partition PartitionID, op Operation)) Option {
+	return func(opts *serviceOptions) {
+		opts.crashHandler = handler
+	}
+}
+
+// WithKeyHash replaces the hash function used by PartitionOf, the default is 64-bit FNV-1a.
+// All nodes and clients of a cluster must use the same function
+func WithKeyHash(hash func(key []byte) uint64) Option {
+	return func(opts *serviceOptions) {
+		opts.keyHash = hash
+	}
+}
+
+// WithHandoffTimeout sets how long a new owner waits for the previous holder of a partition to release it,
+// after that the new owner takes the partition over with a newer epoch. Zero, the default, waits until
+// the previous holder releases the partition or leaves the cluster
+func WithHandoffTimeout(timeout time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.handoffTimeout = timeout
+	}
+}
+
+// WithMigrationLimit moves at most limit partitions of a node to other nodes at the same time,
+// e.g. when nodes join, the other moves wait until one of them is released. Zero, the default, has no limit.
+// Moves of partitions not held by alive nodes are never postponed
+func WithMigrationLimit(limit int) Option {
+	return func(opts *serviceOptions) {
+		opts.migrationLimit = limit
+	}
+}
+
+// WithSettleDelay waits until the membership has not changed for the delay before reallocating partitions,
+// so nodes flapping or a rolling deploy cause a single reallocation. Zero, the default, reallocates immediately
+func WithSettleDelay(delay time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.settleDelay = delay
+	}
+}
+
+// WithReservationPeriod keeps the partitions of a node that left the cluster without a graceful leave
+// reserved for the period, they are reallocated only if the node does not come back before it ends
+func WithReservationPeriod(period time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.reservationPeriod = period
+	}
+}
+
+// WithRejoinInterval sets how often the static addresses that are not members are joined again,
+// so a node split from them heals after the network is. Zero disables it, the default is 30 seconds
+func WithRejoinInterval(interval time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.rejoinInterval = interval
+	}
+}
+
+// WithJoinBackoff sets the range of delays between failed joins, the delay doubles with each failure
+// and is randomized between half and all of it. The defaults are 500 milliseconds and 30 seconds
+func WithJoinBackoff(minDelay time.Duration, maxDelay time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.joinMinDelay = minDelay
+		opts.joinMaxDelay = maxDelay
+	}
+}
+
+// WithDNSDiscovery resolves the name periodically and joins the resolved addresses, in addition to the static addresses.
+// The addresses are the A and AAAA records of the name with the port, or the SRV records of the name when port is zero.
+// The first join waits for the first resolution. A refresh interval of zero means 30 seconds
+func WithDNSDiscovery(name string, port int, refreshInterval time.Duration) Option {
+	if refreshInterval <= 0 {
+		refreshInterval = 30 * time.Second
+	}
+	return func(opts *serviceOptions) {
+		opts.dnsDiscovery = &dnsDiscovery{name: name, port: port}
+		opts.dnsRefreshInterval = refreshInterval
+	}
+}
+
+// WithResolver replaces the resolver of DNS discovery, the default is net.DefaultResolver
+func WithResolver(resolver Resolver) Option {
+	return func(opts *serviceOptions) {
+		opts.resolver = resolver
+	}
+}
+
+// WithAckedBroadcasts numbers the partition broadcasts of this node and retransmits them every interval
+// until all members acknowledge them, giving at-least-once delivery on top of a lossy broadcast.
+// Nodes of older versions ignore numbered broadcasts, so all nodes must support them before it is enabled
+func WithAckedBroadcasts(retransmitInterval time.Duration) Option {
+	return func(opts *serviceOptions) {
+		opts.ackInterval = retransmitInterval
+	}
+}
+
+// WithAckWindow sets the maximum number of acknowledged broadcasts tracked from the oldest unacknowledged one,
+// the default is 1024. Older broadcasts are given up when it is exceeded and counted by Stats.BroadcastOverflows
+func WithAckWindow(size int) Option {
+	return func(opts *serviceOptions) {
+		opts.ackWindowSize = size
+	}
+}
+
+// WithCheckpointStore sets the store of the checkpoints of partitions, it is used by services created by NewV2.
+// It is ignored by services created by New, their runners do not have checkpoints
+func WithCheckpointStore(store CheckpointStore) Option {
+	return func(opts *serviceOptions) {
+		opts.checkpointStore = store
+	}
+}
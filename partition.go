@@ -1,5 +1,7 @@
 package shim
 
+import "sort"
+
 type partitionStatus int
 
 const (
@@ -17,19 +19,38 @@ type partitionState struct {
 	incarnation uint64
 	current     string
 	left        bool
+
+	// unhealthy is set when the runner of the current holder was reported unhealthy,
+	// the holder then releases the partition and it is allocated to another node
+	unhealthy bool
+
+	// failures is the number of consecutive failed starts or stops,
+	// retrying is set while waiting for the backoff before the next attempt
+	failures int
+	retrying bool
+
+	// waitingHandoff is set while the partition is owned by this node but still held by another node,
+	// handoffExpired allows taking it over without waiting for the release of the previous holder
+	waitingHandoff bool
+	handoffExpired bool
 }
 
 type partitionMsg struct {
 	incarnation uint64
 	current     string
 	left        bool
+	unhealthy   bool
 }
 
 //go:generate moq -out partition_mocks_test.go . partitionDelegate
 
 type partitionDelegate interface {
-	start()
+	start(epoch Epoch)
 	stop()
+	cancelStart()
+	scheduleRetry(failures int)
+	waitHandoff()
+	handoffCompleted(forced bool)
 	broadcast(msg partitionMsg)
 }
 
@@ -37,6 +58,13 @@ type partition struct {
 	self     string
 	delegate partitionDelegate
 	state    partitionState
+
+	// startingIncarnation is the incarnation of the run being started, it is the fencing token given to the runner
+	startingIncarnation uint64
+
+	// abandonedIncarnation is the incarnation of the last start abandoned after its deadline,
+	// the runner may still complete it so the next start uses a newer one
+	abandonedIncarnation uint64
 }
 
 func newPartition(selfName string, delegate partitionDelegate) partition {
@@ -58,20 +86,56 @@ func (p *partition) handleStateChanged() {
 }
 
 func (p *partition) handleStateChangedWhenStopped() {
+	// this node stops its runs only by leaving them, an unfinished run of its own
+	// belongs to a previous process, e.g. restarted under the same name, and it is not running anymore
+	if p.state.current == p.self && !p.state.left {
+		p.state.left = true
+		p.delegate.broadcast(p.getPartitionMsg())
+	}
+
+	if p.state.retrying || p.state.shuttingDown {
+		return
+	}
+
 	if p.state.owner != p.self {
+		p.state.waitingHandoff = false
+		p.state.handoffExpired = false
 		return
 	}
 
-	if p.state.current != "" && !p.state.left {
+	// a partition released by this node because it was unhealthy is only restarted here by reallocate
+	if p.state.current == p.self && p.state.unhealthy {
 		return
 	}
 
+	if p.state.current != "" && !p.state.left && !p.state.handoffExpired {
+		if !p.state.waitingHandoff {
+			p.state.waitingHandoff = true
+			p.delegate.waitHandoff()
+		}
+		return
+	}
+
+	if p.state.waitingHandoff {
+		p.state.waitingHandoff = false
+		p.delegate.handoffCompleted(p.state.handoffExpired)
+	}
+	p.state.handoffExpired = false
+
 	p.state.status = partitionStatusStarting
-	p.delegate.start()
+	p.startingIncarnation = p.state.incarnation + 1
+	if p.abandonedIncarnation >= p.startingIncarnation {
+		p.startingIncarnation = p.abandonedIncarnation + 1
+	}
+	p.delegate.start(Epoch{Incarnation: p.startingIncarnation, Node: p.self})
 }
 
 func (p *partition) handleStateChangedWhenRunning() {
-	if p.state.owner == p.self {
+	if p.state.retrying {
+		return
+	}
+
+	if p.state.owner == p.self && p.state.current == p.self && !p.state.shuttingDown && !p.state.unhealthy {
 		return
 	}
 
@@ -82,6 +146,9 @@ func (p *partition) handleStateChangedWhenRunning() {
 func (p *partition) updateOwner(owner string) {
 	defer p.handleStateChanged()
 
+	if p.state.status == partitionStatusStarting && p.state.owner == p.self && owner != p.self {
+		p.delegate.cancelStart()
+	}
 	p.state.owner = owner
 }
 
@@ -92,10 +159,13 @@ func (p *partition) completeStarting() {
 		return
 	}
 
-	p.state.incarnation++
+	// a newer run seen while starting supersedes this one, the partition is then stopped
 	p.state.status = partitionStatusRunning
-	p.state.current = p.self
-	p.state.left = false
+	p.state.failures = 0
+	p.state.updateByMsg(partitionMsg{
+		incarnation: p.startingIncarnation,
+		current:     p.self,
+	})
 
 	p.delegate.broadcast(p.getPartitionMsg())
 }
@@ -108,11 +178,130 @@ func (p *partition) completeStopping() {
 	}
 
 	p.state.status = partitionStatusStopped
-	p.state.left = true
+	p.state.failures = 0
 
+	// another node has already taken over with a newer incarnation
+	if p.state.current != p.self {
+		return
+	}
+
+	p.state.left = true
 	p.delegate.broadcast(p.getPartitionMsg())
 }
 
+// shutdown stops the partition for good, a start in progress is cancelled
+func (p *partition) shutdown() {
+	defer p.handleStateChanged()
+
+	if p.state.shuttingDown {
+		return
+	}
+	if p.state.status == partitionStatusStarting && p.state.owner == p.self {
+		p.delegate.cancelStart()
+	}
+	p.state.shuttingDown = true
+}
+
+// startFailed is called when the runner failed to start the partition,
+// the start is retried after a backoff unless the partition has been allocated to another node meanwhile
+func (p *partition) startFailed() {
+	defer p.handleStateChanged()
+
+	if p.state.status != partitionStatusStarting {
+		return
+	}
+
+	p.state.status = partitionStatusStopped
+	if p.state.owner != p.self {
+		return
+	}
+	p.retryLater()
+}
+
+// adoptStart runs the partition with a start that completed after its deadline, when this node would start it again
+// and no newer run is known. It returns false when the start must be stopped instead
+func (p *partition) adoptStart(incarnation uint64) bool {
+	if p.state.status != partitionStatusStopped || p.state.owner != p.self || p.state.shuttingDown {
+		return false
+	}
+	if p.state.incarnation >= incarnation || p.state.unhealthy {
+		return false
+	}
+	if p.state.current != "" && p.state.current != p.self && !p.state.left {
+		return false
+	}
+
+	p.state.retrying = false
+	p.state.status = partitionStatusStarting
+	p.startingIncarnation = incarnation
+	p.completeStarting()
+	return true
+}
+
+// startTimedOut is called when the start did not complete before its deadline, it is then handled as a failed start
+func (p *partition) startTimedOut() {
+	if p.state.status == partitionStatusStarting {
+		p.abandonedIncarnation = p.startingIncarnation
+	}
+	p.startFailed()
+}
+
+// stopFailed is called when the runner failed to stop the partition, it is considered still running
+func (p *partition) stopFailed() {
+	defer p.handleStateChanged()
+
+	if p.state.status != partitionStatusStopping {
+		return
+	}
+
+	p.state.status = partitionStatusRunning
+	p.retryLater()
+}
+
+func (p *partition) retryLater() {
+	p.state.failures++
+	p.state.retrying = true
+	p.delegate.scheduleRetry(p.state.failures)
+}
+
+// expireHandoff stops waiting for the release of the previous holder,
+// the partition is then started with a newer incarnation which fences the previous holder
+func (p *partition) expireHandoff() {
+	defer p.handleStateChanged()
+
+	if !p.state.waitingHandoff {
+		return
+	}
+	p.state.handoffExpired = true
+}
+
+// reportUnhealthy releases the partition when this node is running it, it returns false otherwise
+func (p *partition) reportUnhealthy() bool {
+	defer p.handleStateChanged()
+
+	if p.state.status != partitionStatusRunning || p.state.current != p.self || p.state.unhealthy {
+		return false
+	}
+	p.state.unhealthy = true
+	return true
+}
+
+// recovered allows this node to run the partition again after it released it because it was unhealthy
+func (p *partition) recovered() {
+	defer p.handleStateChanged()
+
+	if p.state.current != p.self {
+		return
+	}
+	p.state.unhealthy = false
+}
+
+func (p *partition) retry() {
+	defer p.handleStateChanged()
+
+	p.state.retrying = false
+}
+
 func (p *partition) recvBroadcast(msg partitionMsg) {
 	defer p.handleStateChanged()
 
@@ -132,13 +321,28 @@ func (p *partition) getPartitionMsg() partitionMsg {
 		incarnation: p.state.incarnation,
 		current:     p.state.current,
 		left:        p.state.left,
+		unhealthy:   p.state.unhealthy,
+	}
+}
+
+func (s *partitionState) epoch() Epoch {
+	return Epoch{Incarnation: s.incarnation, Node: s.current}
+}
+
+// holder returns the node that is known to be running the partition,
+// or an empty string when nobody is running it
+func (s *partitionState) holder() string {
+	if s.left {
+		return ""
 	}
+	return s.current
 }
 
 func (s *partitionState) setCurrentState(msg partitionMsg) {
 	s.current = msg.current
 	s.incarnation = msg.incarnation
 	s.left = msg.left
+	s.unhealthy = msg.unhealthy
 }
 
 func (s *partitionState) updateByMsg(msg partitionMsg) {
@@ -160,53 +364,102 @@ func (s *partitionState) updateByMsg(msg partitionMsg) {
 		return
 	}
 
+	// the unhealthy release is sent apart from the left message, it may be received after it
 	if s.left {
+		s.unhealthy = s.unhealthy || (msg.left && msg.unhealthy)
 		return
 	}
 	s.left = msg.left
+	s.unhealthy = msg.unhealthy
 }
 
 type partitionAssigns map[string][]PartitionID
 
 func reallocatePartitions(count int, nodes []string, current partitionAssigns) partitionAssigns {
-	high := (count + len(nodes) - 1) / len(nodes)
-	low := count / len(nodes)
-	highCount := count - low*len(nodes)
+	weights := make([]int, len(nodes))
+	for i := range weights {
+		weights[i] = 1
+	}
+	return reallocateWeightedPartitions(count, nodes, weights, current)
+}
 
-	allocatedPartitions := make([]bool, count)
+// computeQuotas splits count proportionally to the weights using the largest remainder method,
+// ties are given to the nodes appearing first
+func computeQuotas(count int, weights []int) []int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
 
-	allocated := make([][]PartitionID, len(nodes))
-	for i, node := range nodes {
-		numPartitions := low
-		if i < highCount {
-			numPartitions = high
-		}
+	quotas := make([]int, len(weights))
+	remainders := make([]int, len(weights))
+	allocated := 0
+	for i, w := range weights {
+		quotas[i] = count * w / total
+		remainders[i] = count * w % total
+		allocated += quotas[i]
+	}
 
-		n := len(current[node])
-		if n > numPartitions {
-			n = numPartitions
-		}
+	indices := make([]int, len(weights))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return remainders[indices[i]] > remainders[indices[j]]
+	})
+
+	for _, index := range indices[:count-allocated] {
+		quotas[index]++
+	}
+	return quotas
+}
+
+func reallocateWeightedPartitions(
+	count int, nodes []string, weights []int, current partitionAssigns,
+) partitionAssigns {
+	partitions := make([]PartitionID, count)
+	for i := range partitions {
+		partitions[i] = PartitionID(i)
+	}
+	return reallocateWeightedSubset(partitions, nodes, weights, current)
+}
+
+// reallocateWeightedSubset allocates the given partitions to nodes proportionally to weights,
+// keeping the current partitions of each node up to its quota, partitions not in the list are ignored
+func reallocateWeightedSubset(
+	partitions []PartitionID, nodes []string, weights []int, current partitionAssigns,
+) partitionAssigns {
+	quotas := computeQuotas(len(partitions), weights)
+
+	freeSet := map[PartitionID]struct{}{}
+	for _, p := range partitions {
+		freeSet[p] = struct{}{}
+	}
 
-		allocated[i] = current[node][:n]
-		for _, p := range allocated[i] {
-			allocatedPartitions[p] = true
+	allocated := make([][]PartitionID, len(nodes))
+	for i, node := range nodes {
+		for _, p := range current[node] {
+			if len(allocated[i]) >= quotas[i] {
+				break
+			}
+			if _, free := freeSet[p]; !free {
+				continue
+			}
+			allocated[i] = append(allocated[i], p)
+			delete(freeSet, p)
 		}
 	}
 
 	var freePartitions []PartitionID
-	for p, used := range allocatedPartitions {
-		if !used {
-			freePartitions = append(freePartitions, PartitionID(p))
+	for _, p := range partitions {
+		if _, free := freeSet[p]; free {
+			freePartitions = append(freePartitions, p)
 		}
 	}
 
 	result := partitionAssigns{}
 	for i, node := range nodes {
-		numPartitions := low
-		if i < highCount {
-			numPartitions = high
-		}
-		missing := numPartitions - len(allocated[i])
+		missing := quotas[i] - len(allocated[i])
 
 		result[node] = append(result[node], allocated[i]...)
 		result[node] = append(result[node], freePartitions[:missing]...)
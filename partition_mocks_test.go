@@ -13,35 +13,59 @@ var _ partitionDelegate = &partitionDelegateMock{}
 
 // partitionDelegateMock is a mock implementation of partitionDelegate.
 //
-// 	func TestSomethingThatUsespartitionDelegate(t *testing.T) {
+//	func TestSomethingThatUsespartitionDelegate(t *testing.T) {
 //
-// 		// make and configure a mocked partitionDelegate
-// 		mockedpartitionDelegate := &partitionDelegateMock{
-// 			broadcastFunc: func(msg partitionMsg)  {
-// 				panic("mock out the broadcast method")
-// 			},
-// 			startFunc: func()  {
-// 				panic("mock out the startJoin method")
-// 			},
-// 			stopFunc: func()  {
-// 				panic("mock out the stop method")
-// 			},
-// 		}
+//		// make and configure a mocked partitionDelegate
+//		mockedpartitionDelegate := &partitionDelegateMock{
+//			broadcastFunc: func(msg partitionMsg)  {
+//				panic("mock out the broadcast method")
+//			},
+//			cancelStartFunc: func()  {
+//				panic("mock out the cancelStart method")
+//			},
+//			handoffCompletedFunc: func(forced bool)  {
+//				panic("mock out the handoffCompleted method")
+//			},
+//			scheduleRetryFunc: func(failures int)  {
+//				panic("mock out the scheduleRetry method")
+//			},
+//			startFunc: func(epoch Epoch)  {
+//				panic("mock out the start method")
+//			},
+//			stopFunc: func()  {
+//				panic("mock out the stop method")
+//			},
+//			waitHandoffFunc: func()  {
+//				panic("mock out the waitHandoff method")
+//			},
+//		}
 //
-// 		// use mockedpartitionDelegate in code that requires partitionDelegate
-// 		// and then make assertions.
+//		// use mockedpartitionDelegate in code that requires partitionDelegate
+//		// and then make assertions.
 //
-// 	}
+//	}
 type partitionDelegateMock struct {
 	// broadcastFunc mocks the broadcast method.
 	broadcastFunc func(msg partitionMsg)
 
-	// startFunc mocks the startJoin method.
-	startFunc func()
+	// cancelStartFunc mocks the cancelStart method.
+	cancelStartFunc func()
+
+	// handoffCompletedFunc mocks the handoffCompleted method.
+	handoffCompletedFunc func(forced bool)
+
+	// scheduleRetryFunc mocks the scheduleRetry method.
+	scheduleRetryFunc func(failures int)
+
+	// startFunc mocks the start method.
+	startFunc func(epoch Epoch)
 
 	// stopFunc mocks the stop method.
 	stopFunc func()
 
+	// waitHandoffFunc mocks the waitHandoff method.
+	waitHandoffFunc func()
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// broadcast holds details about calls to the broadcast method.
@@ -49,16 +73,38 @@ type partitionDelegateMock struct {
 			// Msg is the msg argument value.
 			Msg partitionMsg
 		}
-		// startJoin holds details about calls to the startJoin method.
+		// cancelStart holds details about calls to the cancelStart method.
+		cancelStart []struct {
+		}
+		// handoffCompleted holds details about calls to the handoffCompleted method.
+		handoffCompleted []struct {
+			// Forced is the forced argument value.
+			Forced bool
+		}
+		// scheduleRetry holds details about calls to the scheduleRetry method.
+		scheduleRetry []struct {
+			// Failures is the failures argument value.
+			Failures int
+		}
+		// start holds details about calls to the start method.
 		start []struct {
+			// Epoch is the epoch argument value.
+			Epoch Epoch
 		}
 		// stop holds details about calls to the stop method.
 		stop []struct {
 		}
+		// waitHandoff holds details about calls to the waitHandoff method.
+		waitHandoff []struct {
+		}
 	}
-	lockbroadcast sync.RWMutex
-	lockstart     sync.RWMutex
-	lockstop      sync.RWMutex
+	lockbroadcast        sync.RWMutex
+	lockcancelStart      sync.RWMutex
+	lockhandoffCompleted sync.RWMutex
+	lockscheduleRetry    sync.RWMutex
+	lockstart            sync.RWMutex
+	lockstop             sync.RWMutex
+	lockwaitHandoff      sync.RWMutex
 }
 
 // broadcast calls broadcastFunc.
@@ -79,7 +125,8 @@ func (mock *partitionDelegateMock) broadcast(msg partitionMsg) {
 
 // broadcastCalls gets all the calls that were made to broadcast.
 // Check the length with:
-//     len(mockedpartitionDelegate.broadcastCalls())
+//
+//	len(mockedpartitionDelegate.broadcastCalls())
 func (mock *partitionDelegateMock) broadcastCalls() []struct {
 	Msg partitionMsg
 } {
@@ -92,25 +139,122 @@ func (mock *partitionDelegateMock) broadcastCalls() []struct {
 	return calls
 }
 
-// startJoin calls startFunc.
-func (mock *partitionDelegateMock) start() {
-	if mock.startFunc == nil {
-		panic("partitionDelegateMock.startFunc: method is nil but partitionDelegate.startJoin was just called")
+// cancelStart calls cancelStartFunc.
+func (mock *partitionDelegateMock) cancelStart() {
+	if mock.cancelStartFunc == nil {
+		panic("partitionDelegateMock.cancelStartFunc: method is nil but partitionDelegate.cancelStart was just called")
 	}
 	callInfo := struct {
 	}{}
+	mock.lockcancelStart.Lock()
+	mock.calls.cancelStart = append(mock.calls.cancelStart, callInfo)
+	mock.lockcancelStart.Unlock()
+	mock.cancelStartFunc()
+}
+
+// cancelStartCalls gets all the calls that were made to cancelStart.
+// Check the length with:
+//
+//	len(mockedpartitionDelegate.cancelStartCalls())
+func (mock *partitionDelegateMock) cancelStartCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockcancelStart.RLock()
+	calls = mock.calls.cancelStart
+	mock.lockcancelStart.RUnlock()
+	return calls
+}
+
+// handoffCompleted calls handoffCompletedFunc.
+func (mock *partitionDelegateMock) handoffCompleted(forced bool) {
+	if mock.handoffCompletedFunc == nil {
+		panic("partitionDelegateMock.handoffCompletedFunc: method is nil but partitionDelegate.handoffCompleted was just called")
+	}
+	callInfo := struct {
+		Forced bool
+	}{
+		Forced: forced,
+	}
+	mock.lockhandoffCompleted.Lock()
+	mock.calls.handoffCompleted = append(mock.calls.handoffCompleted, callInfo)
+	mock.lockhandoffCompleted.Unlock()
+	mock.handoffCompletedFunc(forced)
+}
+
+// handoffCompletedCalls gets all the calls that were made to handoffCompleted.
+// Check the length with:
+//
+//	len(mockedpartitionDelegate.handoffCompletedCalls())
+func (mock *partitionDelegateMock) handoffCompletedCalls() []struct {
+	Forced bool
+} {
+	var calls []struct {
+		Forced bool
+	}
+	mock.lockhandoffCompleted.RLock()
+	calls = mock.calls.handoffCompleted
+	mock.lockhandoffCompleted.RUnlock()
+	return calls
+}
+
+// scheduleRetry calls scheduleRetryFunc.
+func (mock *partitionDelegateMock) scheduleRetry(failures int) {
+	if mock.scheduleRetryFunc == nil {
+		panic("partitionDelegateMock.scheduleRetryFunc: method is nil but partitionDelegate.scheduleRetry was just called")
+	}
+	callInfo := struct {
+		Failures int
+	}{
+		Failures: failures,
+	}
+	mock.lockscheduleRetry.Lock()
+	mock.calls.scheduleRetry = append(mock.calls.scheduleRetry, callInfo)
+	mock.lockscheduleRetry.Unlock()
+	mock.scheduleRetryFunc(failures)
+}
+
+// scheduleRetryCalls gets all the calls that were made to scheduleRetry.
+// Check the length with:
+//
+//	len(mockedpartitionDelegate.scheduleRetryCalls())
+func (mock *partitionDelegateMock) scheduleRetryCalls() []struct {
+	Failures int
+} {
+	var calls []struct {
+		Failures int
+	}
+	mock.lockscheduleRetry.RLock()
+	calls = mock.calls.scheduleRetry
+	mock.lockscheduleRetry.RUnlock()
+	return calls
+}
+
+// start calls startFunc.
+func (mock *partitionDelegateMock) start(epoch Epoch) {
+	if mock.startFunc == nil {
+		panic("partitionDelegateMock.startFunc: method is nil but partitionDelegate.start was just called")
+	}
+	callInfo := struct {
+		Epoch Epoch
+	}{
+		Epoch: epoch,
+	}
 	mock.lockstart.Lock()
 	mock.calls.start = append(mock.calls.start, callInfo)
 	mock.lockstart.Unlock()
-	mock.startFunc()
+	mock.startFunc(epoch)
 }
 
-// startCalls gets all the calls that were made to startJoin.
+// startCalls gets all the calls that were made to start.
 // Check the length with:
-//     len(mockedpartitionDelegate.startCalls())
+//
+//	len(mockedpartitionDelegate.startCalls())
 func (mock *partitionDelegateMock) startCalls() []struct {
+	Epoch Epoch
 } {
 	var calls []struct {
+		Epoch Epoch
 	}
 	mock.lockstart.RLock()
 	calls = mock.calls.start
@@ -133,7 +277,8 @@ func (mock *partitionDelegateMock) stop() {
 
 // stopCalls gets all the calls that were made to stop.
 // Check the length with:
-//     len(mockedpartitionDelegate.stopCalls())
+//
+//	len(mockedpartitionDelegate.stopCalls())
 func (mock *partitionDelegateMock) stopCalls() []struct {
 } {
 	var calls []struct {
@@ -143,3 +288,30 @@ func (mock *partitionDelegateMock) stopCalls() []struct {
 	mock.lockstop.RUnlock()
 	return calls
 }
+
+// waitHandoff calls waitHandoffFunc.
+func (mock *partitionDelegateMock) waitHandoff() {
+	if mock.waitHandoffFunc == nil {
+		panic("partitionDelegateMock.waitHandoffFunc: method is nil but partitionDelegate.waitHandoff was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockwaitHandoff.Lock()
+	mock.calls.waitHandoff = append(mock.calls.waitHandoff, callInfo)
+	mock.lockwaitHandoff.Unlock()
+	mock.waitHandoffFunc()
+}
+
+// waitHandoffCalls gets all the calls that were made to waitHandoff.
+// Check the length with:
+//
+//	len(mockedpartitionDelegate.waitHandoffCalls())
+func (mock *partitionDelegateMock) waitHandoffCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockwaitHandoff.RLock()
+	calls = mock.calls.waitHandoff
+	mock.lockwaitHandoff.RUnlock()
+	return calls
+}
@@ -11,7 +11,7 @@ func TestPartition_UpdateOwner_To_Self_Node__Start(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {
+	delegate.startFunc = func(Epoch) {
 	}
 
 	p.updateOwner("self-node")
@@ -30,7 +30,7 @@ func TestPartition_CompleteStarting_Broadcast(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	var broadcastMsg partitionMsg
@@ -106,6 +106,8 @@ func TestPartition_RecvBroadcast_Then_Update_Owner__Do_Nothing(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
+	delegate.waitHandoffFunc = func() {}
+
 	p.recvBroadcast(partitionMsg{
 		current:     "other-node",
 		incarnation: 2,
@@ -114,10 +116,12 @@ func TestPartition_RecvBroadcast_Then_Update_Owner__Do_Nothing(t *testing.T) {
 	p.updateOwner("self-node")
 
 	assert.Equal(t, 0, len(delegate.startCalls()))
+	assert.Equal(t, 1, len(delegate.waitHandoffCalls()))
 	assert.Equal(t, partitionState{
-		owner:       "self-node",
-		current:     "other-node",
-		incarnation: 2,
+		owner:          "self-node",
+		current:        "other-node",
+		incarnation:    2,
+		waitingHandoff: true,
 	}, p.state)
 }
 
@@ -162,7 +166,7 @@ func TestPartition_Node_Leave__Same_Node(t *testing.T) {
 
 	p.nodeLeave("other-node")
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 
 	p.updateOwner("self-node")
 
@@ -182,6 +186,8 @@ func TestPartition_Node_Leave_Other_Node__Do_Nothing(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
+	delegate.waitHandoffFunc = func() {}
+
 	p.recvBroadcast(partitionMsg{
 		current:     "other-node",
 		incarnation: 2,
@@ -192,10 +198,11 @@ func TestPartition_Node_Leave_Other_Node__Do_Nothing(t *testing.T) {
 	p.updateOwner("self-node")
 
 	assert.Equal(t, partitionState{
-		status:      partitionStatusStopped,
-		owner:       "self-node",
-		current:     "other-node",
-		incarnation: 2,
+		status:         partitionStatusStopped,
+		owner:          "self-node",
+		current:        "other-node",
+		incarnation:    2,
+		waitingHandoff: true,
 	}, p.state)
 }
 
@@ -232,6 +239,9 @@ func TestPartition_Recv_Broadcast_Update_Owner_Then_Leave(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
+	delegate.waitHandoffFunc = func() {}
+	delegate.handoffCompletedFunc = func(forced bool) {}
+
 	p.recvBroadcast(partitionMsg{
 		current:     "other-node",
 		incarnation: 2,
@@ -239,7 +249,7 @@ func TestPartition_Recv_Broadcast_Update_Owner_Then_Leave(t *testing.T) {
 
 	p.updateOwner("self-node")
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 
 	p.nodeLeave("other-node")
 
@@ -259,6 +269,9 @@ func TestPartition_Recv_Broadcast_Update_Owner_Then_Leave_Second_Times(t *testin
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
+	delegate.waitHandoffFunc = func() {}
+	delegate.handoffCompletedFunc = func(forced bool) {}
+
 	p.recvBroadcast(partitionMsg{
 		current:     "other-node",
 		incarnation: 2,
@@ -266,7 +279,7 @@ func TestPartition_Recv_Broadcast_Update_Owner_Then_Leave_Second_Times(t *testin
 
 	p.updateOwner("self-node")
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 
 	p.nodeLeave("other-node")
 	p.nodeLeave("other-node")
@@ -317,7 +330,7 @@ func TestPartition_Recv_Broadcast_Then_Running(t *testing.T) {
 
 	p.nodeLeave("other-node")
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	var broadcastMsg partitionMsg
@@ -340,21 +353,24 @@ func TestPartition_Recv_Broadcast_Then_Running(t *testing.T) {
 	}, p.state)
 }
 
-func TestPartition_Change_Owner_When_Starting__Do_Nothing(t *testing.T) {
+func TestPartition_Change_Owner_When_Starting__Cancel_Start(t *testing.T) {
 	t.Parallel()
 
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
+	delegate.cancelStartFunc = func() {}
 	p.updateOwner("self-node")
 
 	p.updateOwner("other-node")
+	p.updateOwner("another-node")
 
 	assert.Equal(t, 1, len(delegate.startCalls()))
+	assert.Equal(t, 1, len(delegate.cancelStartCalls()))
 	assert.Equal(t, partitionState{
 		status: partitionStatusStarting,
-		owner:  "other-node",
+		owner:  "another-node",
 	}, p.state)
 }
 
@@ -364,7 +380,7 @@ func TestPartition_Change_Owner_When_Running(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	delegate.broadcastFunc = func(msg partitionMsg) {}
@@ -390,7 +406,7 @@ func TestPartition_CompleteStopping(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	delegate.broadcastFunc = func(msg partitionMsg) {}
@@ -426,7 +442,7 @@ func TestPartition_Update_Owner_Back__Then_CompleteStopping(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	delegate.broadcastFunc = func(msg partitionMsg) {}
@@ -483,7 +499,7 @@ func TestPartition_GetPartitionMsg__WhenRunning(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
 	p.updateOwner("self-node")
 
 	assert.Equal(t, partitionMsg{
@@ -508,7 +524,8 @@ func TestPartition_GetPartitionMsg__When_Stopped(t *testing.T) {
 	delegate := &partitionDelegateMock{}
 	p := newPartition("self-node", delegate)
 
-	delegate.startFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
+	delegate.cancelStartFunc = func() {}
 	p.updateOwner("self-node")
 
 	p.updateOwner("other-node")
@@ -832,3 +849,349 @@ func TestReallocatePartitions(t *testing.T) {
 		})
 	}
 }
+
+func TestPartition_Running_Recv_Newer_Broadcast_From_Other_Node__Stop(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.waitHandoffFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
+	p.updateOwner("self-node")
+
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+	p.completeStarting()
+
+	delegate.stopFunc = func() {}
+	p.recvBroadcast(partitionMsg{
+		current:     "other-node",
+		incarnation: 2,
+	})
+
+	assert.Equal(t, 1, len(delegate.stopCalls()))
+	assert.Equal(t, partitionState{
+		status:      partitionStatusStopping,
+		owner:       "self-node",
+		current:     "other-node",
+		incarnation: 2,
+	}, p.state)
+
+	p.completeStopping()
+
+	assert.Equal(t, 1, len(delegate.broadcastCalls()))
+	assert.Equal(t, partitionState{
+		status:         partitionStatusStopped,
+		owner:          "self-node",
+		current:        "other-node",
+		incarnation:    2,
+		waitingHandoff: true,
+	}, p.state)
+}
+
+func TestComputeQuotas(t *testing.T) {
+	table := []struct {
+		name     string
+		count    int
+		weights  []int
+		expected []int
+	}{
+		{name: "equal", count: 7, weights: []int{1, 1, 1}, expected: []int{3, 2, 2}},
+		{name: "proportional", count: 10, weights: []int{1, 4}, expected: []int{2, 8}},
+		{name: "largest-remainder", count: 10, weights: []int{1, 2, 3}, expected: []int{2, 3, 5}},
+		{name: "largest-remainder-before-tie", count: 5, weights: []int{2, 2, 4}, expected: []int{1, 1, 3}},
+		{name: "more-weight-than-partitions", count: 2, weights: []int{8, 32}, expected: []int{0, 2}},
+	}
+
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			assert.Equal(t, e.expected, computeQuotas(e.count, e.weights))
+		})
+	}
+}
+
+func TestReallocateWeightedPartitions(t *testing.T) {
+	table := []struct {
+		name     string
+		count    int
+		nodes    []string
+		weights  []int
+		current  partitionAssigns
+		expected partitionAssigns
+	}{
+		{
+			name:    "current-nil",
+			count:   10,
+			nodes:   []string{"A", "B"},
+			weights: []int{1, 4},
+			current: nil,
+			expected: partitionAssigns{
+				"A": {0, 1},
+				"B": {2, 3, 4, 5, 6, 7, 8, 9},
+			},
+		},
+		{
+			name:    "keep-current",
+			count:   10,
+			nodes:   []string{"A", "B"},
+			weights: []int{1, 4},
+			current: partitionAssigns{
+				"A": {9, 3, 5, 7, 1},
+				"B": {0, 2, 4, 6, 8},
+			},
+			expected: partitionAssigns{
+				"A": {9, 3},
+				"B": {0, 2, 4, 6, 8, 1, 5, 7},
+			},
+		},
+		{
+			name:    "heavy-node-join",
+			count:   8,
+			nodes:   []string{"A", "B", "C"},
+			weights: []int{1, 1, 2},
+			current: partitionAssigns{
+				"A": {0, 1, 2, 3},
+				"B": {4, 5, 6, 7},
+			},
+			expected: partitionAssigns{
+				"A": {0, 1},
+				"B": {4, 5},
+				"C": {2, 3, 6, 7},
+			},
+		},
+	}
+
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			result := reallocateWeightedPartitions(e.count, e.nodes, e.weights, e.current)
+			assert.Equal(t, e.expected, result)
+		})
+	}
+}
+
+func TestPartition_Start__With_Next_Epoch(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("node01", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.recvBroadcast(partitionMsg{incarnation: 3, current: "node02", left: true})
+	p.updateOwner("node01")
+
+	assert.Equal(t, 1, len(delegate.startCalls()))
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, delegate.startCalls()[0].Epoch)
+
+	p.completeStarting()
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, p.state.epoch())
+}
+
+func TestPartition_Newer_Run_Seen_While_Starting__Stop_After_Started(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("node01", delegate)
+
+	delegate.waitHandoffFunc = func() {}
+	delegate.startFunc = func(Epoch) {}
+	delegate.stopFunc = func() {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.updateOwner("node01")
+	p.recvBroadcast(partitionMsg{incarnation: 1, current: "node02"})
+	p.completeStarting()
+
+	assert.Equal(t, partitionState{
+		status:      partitionStatusStopping,
+		owner:       "node01",
+		incarnation: 1,
+		current:     "node02",
+	}, p.state)
+	assert.Equal(t, 1, len(delegate.stopCalls()))
+
+	p.completeStopping()
+	assert.Equal(t, partitionStatusStopped, p.state.status)
+	assert.Equal(t, false, p.state.left)
+}
+
+func TestPartition_Recv_Run_Of_Previous_Process__Left__Start_With_Next_Epoch(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("node01", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.recvBroadcast(partitionMsg{incarnation: 3, current: "node01"})
+
+	assert.Equal(t, []partitionMsg{
+		{incarnation: 3, current: "node01", left: true},
+	}, broadcastMsgs(delegate))
+	assert.Equal(t, 0, len(delegate.startCalls()))
+
+	p.updateOwner("node01")
+	assert.Equal(t, partitionState{
+		status:      partitionStatusStarting,
+		owner:       "node01",
+		incarnation: 3,
+		current:     "node01",
+		left:        true,
+	}, p.state)
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, delegate.startCalls()[0].Epoch)
+}
+
+func TestPartition_Start_Failed__Recv_Run_Of_Previous_Process__Left(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("node01", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.scheduleRetryFunc = func(failures int) {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.updateOwner("node01")
+	p.recvBroadcast(partitionMsg{incarnation: 3, current: "node01"})
+	assert.Equal(t, 0, len(delegate.broadcastCalls()))
+
+	p.startFailed()
+	assert.Equal(t, []partitionMsg{
+		{incarnation: 3, current: "node01", left: true},
+	}, broadcastMsgs(delegate))
+
+	p.retry()
+	assert.Equal(t, Epoch{Incarnation: 4, Node: "node01"}, delegate.startCalls()[1].Epoch)
+}
+
+func broadcastMsgs(delegate *partitionDelegateMock) []partitionMsg {
+	var result []partitionMsg
+	for _, call := range delegate.broadcastCalls() {
+		result = append(result, call.Msg)
+	}
+	return result
+}
+
+func TestPartition_Start_Failed__Retry_After_Backoff(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.scheduleRetryFunc = func(failures int) {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.updateOwner("self-node")
+	p.startFailed()
+
+	assert.Equal(t, partitionState{
+		status:   partitionStatusStopped,
+		owner:    "self-node",
+		failures: 1,
+		retrying: true,
+	}, p.state)
+	assert.Equal(t, 1, len(delegate.startCalls()))
+
+	p.updateOwner("self-node")
+	assert.Equal(t, 1, len(delegate.startCalls()))
+
+	p.retry()
+	assert.Equal(t, 2, len(delegate.startCalls()))
+	assert.Equal(t, partitionStatusStarting, p.state.status)
+
+	p.startFailed()
+	assert.Equal(t, 2, p.state.failures)
+	assert.Equal(t, 2, delegate.scheduleRetryCalls()[1].Failures)
+
+	p.retry()
+	p.completeStarting()
+	assert.Equal(t, partitionState{
+		status:      partitionStatusRunning,
+		owner:       "self-node",
+		incarnation: 1,
+		current:     "self-node",
+	}, p.state)
+}
+
+func TestPartition_Start_Cancelled_By_Reallocation__No_Retry(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.cancelStartFunc = func() {}
+
+	p.updateOwner("self-node")
+	p.updateOwner("other-node")
+	p.startFailed()
+
+	assert.Equal(t, partitionState{
+		status: partitionStatusStopped,
+		owner:  "other-node",
+	}, p.state)
+	assert.Equal(t, 1, len(delegate.cancelStartCalls()))
+}
+
+func TestPartition_Stop_Failed__Still_Running__Retry_Stop(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.stopFunc = func() {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+	delegate.scheduleRetryFunc = func(failures int) {}
+
+	p.updateOwner("self-node")
+	p.completeStarting()
+	p.updateOwner("other-node")
+	p.stopFailed()
+
+	assert.Equal(t, partitionState{
+		status:      partitionStatusRunning,
+		owner:       "other-node",
+		incarnation: 1,
+		current:     "self-node",
+		failures:    1,
+		retrying:    true,
+	}, p.state)
+	assert.Equal(t, 1, len(delegate.stopCalls()))
+
+	p.retry()
+	assert.Equal(t, 2, len(delegate.stopCalls()))
+
+	p.completeStopping()
+	assert.Equal(t, partitionStatusStopped, p.state.status)
+	assert.Equal(t, 0, p.state.failures)
+	assert.Equal(t, true, p.state.left)
+}
+
+func TestPartition_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	delegate := &partitionDelegateMock{}
+	p := newPartition("self-node", delegate)
+
+	delegate.startFunc = func(Epoch) {}
+	delegate.stopFunc = func() {}
+	delegate.cancelStartFunc = func() {}
+	delegate.broadcastFunc = func(msg partitionMsg) {}
+
+	p.updateOwner("self-node")
+	p.shutdown()
+	p.shutdown()
+	assert.Equal(t, 1, len(delegate.cancelStartCalls()))
+
+	p.completeStarting()
+	assert.Equal(t, partitionStatusStopping, p.state.status)
+
+	p.completeStopping()
+	p.updateOwner("self-node")
+	assert.Equal(t, partitionStatusStopped, p.state.status)
+	assert.Equal(t, 1, len(delegate.startCalls()))
+}
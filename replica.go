@@ -0,0 +1,118 @@
+package shim
+
+import "sort"
+
+type replicaStatus int
+
+const (
+	replicaStatusStopped replicaStatus = iota
+	replicaStatusStarting
+	replicaStatusRunning
+	replicaStatusStopping
+)
+
+//go:generate moq -out replica_mocks_test.go . replicaDelegate
+
+type replicaDelegate interface {
+	startStandby()
+	stopStandby()
+}
+
+// replica is the standby of a partition on the local node
+type replica struct {
+	delegate replicaDelegate
+	status   replicaStatus
+	wanted   bool
+}
+
+func newReplica(delegate replicaDelegate) replica {
+	return replica{
+		delegate: delegate,
+	}
+}
+
+func (r *replica) handleStateChanged() {
+	switch r.status {
+	case replicaStatusStopped:
+		if r.wanted {
+			r.status = replicaStatusStarting
+			r.delegate.startStandby()
+		}
+	case replicaStatusRunning:
+		if !r.wanted {
+			r.status = replicaStatusStopping
+			r.delegate.stopStandby()
+		}
+	default:
+	}
+}
+
+func (r *replica) setWanted(wanted bool) {
+	defer r.handleStateChanged()
+
+	r.wanted = wanted
+}
+
+func (r *replica) completeStarting() {
+	defer r.handleStateChanged()
+
+	if r.status != replicaStatusStarting {
+		return
+	}
+	r.status = replicaStatusRunning
+}
+
+func (r *replica) completeStopping() {
+	defer r.handleStateChanged()
+
+	if r.status != replicaStatusStopping {
+		return
+	}
+	r.status = replicaStatusStopped
+}
+
+// promote consumes a running standby to become the primary of the partition,
+// returns false when the standby is not ready and the partition must be started from scratch
+func (r *replica) promote() bool {
+	defer r.handleStateChanged()
+
+	r.wanted = false
+	if r.status != replicaStatusRunning {
+		return false
+	}
+	r.status = replicaStatusStopped
+	return true
+}
+
+// computeStandbys returns the ordered standbys of a partition: up to count nodes other than the owner,
+// ranked by their rendezvous scores, so that every node computes the same list from the same members
+func computeStandbys(partition PartitionID, owner string, nodes []NodeInfo, count int) []string {
+	type candidate struct {
+		name  string
+		score float64
+	}
+
+	candidates := make([]candidate, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Name == owner {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			name:  n.Name,
+			score: rendezvousScore(n.Name, partition, n.Weight),
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+
+	result := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		result = append(result, c.name)
+	}
+	return result
+}
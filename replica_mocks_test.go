@@ -0,0 +1,104 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package shim
+
+import (
+	"sync"
+)
+
+// Ensure, that replicaDelegateMock does implement replicaDelegate.
+// If this is not the case, regenerate this file with moq.
+var _ replicaDelegate = &replicaDelegateMock{}
+
+// replicaDelegateMock is a mock implementation of replicaDelegate.
+//
+//	func TestSomethingThatUsesreplicaDelegate(t *testing.T) {
+//
+//		// make and configure a mocked replicaDelegate
+//		mockedreplicaDelegate := &replicaDelegateMock{
+//			startStandbyFunc: func()  {
+//				panic("mock out the startStandby method")
+//			},
+//			stopStandbyFunc: func()  {
+//				panic("mock out the stopStandby method")
+//			},
+//		}
+//
+//		// use mockedreplicaDelegate in code that requires replicaDelegate
+//		// and then make assertions.
+//
+//	}
+type replicaDelegateMock struct {
+	// startStandbyFunc mocks the startStandby method.
+	startStandbyFunc func()
+
+	// stopStandbyFunc mocks the stopStandby method.
+	stopStandbyFunc func()
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// startStandby holds details about calls to the startStandby method.
+		startStandby []struct {
+		}
+		// stopStandby holds details about calls to the stopStandby method.
+		stopStandby []struct {
+		}
+	}
+	lockstartStandby sync.RWMutex
+	lockstopStandby  sync.RWMutex
+}
+
+// startStandby calls startStandbyFunc.
+func (mock *replicaDelegateMock) startStandby() {
+	if mock.startStandbyFunc == nil {
+		panic("replicaDelegateMock.startStandbyFunc: method is nil but replicaDelegate.startStandby was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockstartStandby.Lock()
+	mock.calls.startStandby = append(mock.calls.startStandby, callInfo)
+	mock.lockstartStandby.Unlock()
+	mock.startStandbyFunc()
+}
+
+// startStandbyCalls gets all the calls that were made to startStandby.
+// Check the length with:
+//
+//	len(mockedreplicaDelegate.startStandbyCalls())
+func (mock *replicaDelegateMock) startStandbyCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockstartStandby.RLock()
+	calls = mock.calls.startStandby
+	mock.lockstartStandby.RUnlock()
+	return calls
+}
+
+// stopStandby calls stopStandbyFunc.
+func (mock *replicaDelegateMock) stopStandby() {
+	if mock.stopStandbyFunc == nil {
+		panic("replicaDelegateMock.stopStandbyFunc: method is nil but replicaDelegate.stopStandby was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockstopStandby.Lock()
+	mock.calls.stopStandby = append(mock.calls.stopStandby, callInfo)
+	mock.lockstopStandby.Unlock()
+	mock.stopStandbyFunc()
+}
+
+// stopStandbyCalls gets all the calls that were made to stopStandby.
+// Check the length with:
+//
+//	len(mockedreplicaDelegate.stopStandbyCalls())
+func (mock *replicaDelegateMock) stopStandbyCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockstopStandby.RLock()
+	calls = mock.calls.stopStandby
+	mock.lockstopStandby.RUnlock()
+	return calls
+}
@@ -0,0 +1,115 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newReplicaTest() (*replica, *replicaDelegateMock) {
+	delegate := &replicaDelegateMock{
+		startStandbyFunc: func() {},
+		stopStandbyFunc:  func() {},
+	}
+	r := newReplica(delegate)
+	return &r, delegate
+}
+
+func TestReplica_Set_Wanted__Start_Standby(t *testing.T) {
+	t.Parallel()
+
+	r, delegate := newReplicaTest()
+
+	r.setWanted(true)
+	assert.Equal(t, replicaStatusStarting, r.status)
+	assert.Equal(t, 1, len(delegate.startStandbyCalls()))
+
+	r.setWanted(true)
+	assert.Equal(t, 1, len(delegate.startStandbyCalls()))
+
+	r.completeStarting()
+	assert.Equal(t, replicaStatusRunning, r.status)
+}
+
+func TestReplica_Unwanted_While_Starting__Stop_After_Started(t *testing.T) {
+	t.Parallel()
+
+	r, delegate := newReplicaTest()
+
+	r.setWanted(true)
+	r.setWanted(false)
+	assert.Equal(t, 0, len(delegate.stopStandbyCalls()))
+
+	r.completeStarting()
+	assert.Equal(t, replicaStatusStopping, r.status)
+	assert.Equal(t, 1, len(delegate.stopStandbyCalls()))
+
+	r.completeStopping()
+	assert.Equal(t, replicaStatusStopped, r.status)
+}
+
+func TestReplica_Promote_Running__Consumed(t *testing.T) {
+	t.Parallel()
+
+	r, delegate := newReplicaTest()
+
+	r.setWanted(true)
+	r.completeStarting()
+
+	assert.Equal(t, true, r.promote())
+	assert.Equal(t, replica{delegate: delegate, status: replicaStatusStopped}, *r)
+	assert.Equal(t, 0, len(delegate.stopStandbyCalls()))
+}
+
+func TestReplica_Promote_Not_Running__Cold_Start(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newReplicaTest()
+	assert.Equal(t, false, r.promote())
+
+	r.setWanted(true)
+	assert.Equal(t, false, r.promote())
+	assert.Equal(t, replicaStatusStarting, r.status)
+	assert.Equal(t, false, r.wanted)
+}
+
+func TestComputeStandbys(t *testing.T) {
+	t.Parallel()
+
+	nodes := []NodeInfo{
+		{Name: "node01", Weight: 1},
+		{Name: "node02", Weight: 1},
+		{Name: "node03", Weight: 1},
+		{Name: "node04", Weight: 1},
+	}
+
+	for p := PartitionID(0); p < 32; p++ {
+		standbys := computeStandbys(p, "node02", nodes, 2)
+		assert.Equal(t, 2, len(standbys))
+		assert.NotContains(t, standbys, "node02")
+		assert.NotEqual(t, standbys[0], standbys[1])
+
+		// the order only depends on the candidates
+		assert.Equal(t, standbys, computeStandbys(p, "node02", []NodeInfo{nodes[3], nodes[2], nodes[0]}, 2))
+	}
+
+	assert.Equal(t, []string{"node01"}, computeStandbys(0, "node02", nodes[:2], 3))
+	assert.Equal(t, []string{}, computeStandbys(0, "node01", nodes[:1], 1))
+}
+
+func TestComputeStandbys_First_Standby_Is_Next_Rendezvous_Owner(t *testing.T) {
+	t.Parallel()
+
+	nodes := []NodeInfo{
+		{Name: "node01", Weight: 1},
+		{Name: "node02", Weight: 1},
+		{Name: "node03", Weight: 1},
+	}
+
+	owners := NewRendezvousAllocator().Allocate(16, nodes, nil)
+	for _, p := range owners["node02"] {
+		standby := computeStandbys(p, "node02", nodes, 1)[0]
+
+		remaining := NewRendezvousAllocator().Allocate(16, []NodeInfo{nodes[0], nodes[2]}, nil)
+		assert.Contains(t, remaining[standby], p)
+	}
+}
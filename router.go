@@ -0,0 +1,57 @@
+package shim
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// ErrPartitionNotHeld is returned when no node is known to hold the partition of a key
+var ErrPartitionNotHeld = errors.New("shim: partition is not held by any node")
+
+// Route is the destination of a request
+type Route struct {
+	Partition PartitionID
+	Node      NodeInfo
+
+	// Local is true when the partition is held by this node
+	Local bool
+}
+
+// Router finds the node holding the partition of a key, so that requests can be forwarded to it
+type Router struct {
+	service *Service
+}
+
+// NewRouter ...
+func NewRouter(service *Service) *Router {
+	return &Router{service: service}
+}
+
+// Route returns the destination of the key, or ErrPartitionNotHeld when the partition is being moved
+func (r *Router) Route(key []byte) (Route, error) {
+	partition := r.service.PartitionOf(key)
+	node, ok := r.service.Lookup(partition)
+	if !ok {
+		return Route{Partition: partition}, ErrPartitionNotHeld
+	}
+	return Route{
+		Partition: partition,
+		Node:      node,
+		Local:     node.Name == r.service.selfNode,
+	}, nil
+}
+
+// Addr returns the address of the node holding the partition of the key
+func (r *Router) Addr(key []byte) (string, error) {
+	route, err := r.Route(key)
+	if err != nil {
+		return "", err
+	}
+	return route.Node.Addr, nil
+}
+
+func fnvKeyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	return h.Sum64()
+}
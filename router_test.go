@@ -0,0 +1,99 @@
+package shim
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newRouterTestService(opts ...Option) *Service {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+	}
+	s := New(4, "node01", "address01", runner, opts...)
+	s.NotifyJoin("node02", "address02", nodeMeta{weight: 3}.Marshal())
+	return s
+}
+
+func TestService_PartitionOf(t *testing.T) {
+	s := newRouterTestService()
+
+	assert.Equal(t, PartitionID(fnvKeyHash([]byte("user-1"))%4), s.PartitionOf([]byte("user-1")))
+	assert.Equal(t, uint64(0xcbf29ce484222325), fnvKeyHash(nil))
+
+	s = newRouterTestService(WithKeyHash(func(key []byte) uint64 {
+		return binary.BigEndian.Uint64(key)
+	}))
+	assert.Equal(t, PartitionID(3), s.PartitionOf([]byte{0, 0, 0, 0, 0, 0, 0, 7}))
+}
+
+func TestService_Lookup(t *testing.T) {
+	s := newRouterTestService()
+
+	_, ok := s.Lookup(1)
+	assert.Equal(t, false, ok)
+
+	s.NotifyMsg(partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02"}},
+		{id: 3, msg: partitionMsg{incarnation: 1, current: "node03"}},
+	}.Marshal())
+	s.core.onJoinCompleted()
+
+	node, ok := s.Lookup(1)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, NodeInfo{Name: "node02", Addr: "address02", Weight: 3}, node)
+
+	node, ok = s.Lookup(0)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, NodeInfo{Name: "node01", Addr: "address01", Weight: 1}, node)
+
+	// not a member
+	_, ok = s.Lookup(3)
+	assert.Equal(t, false, ok)
+
+	_, ok = s.Lookup(4)
+	assert.Equal(t, false, ok)
+
+	s.NotifyMsg(partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	}.Marshal())
+	_, ok = s.Lookup(1)
+	assert.Equal(t, false, ok)
+}
+
+func TestRouter_Route(t *testing.T) {
+	s := newRouterTestService(WithKeyHash(func(key []byte) uint64 {
+		return uint64(key[0])
+	}))
+	s.NotifyMsg(partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	}.Marshal())
+	s.core.onJoinCompleted()
+
+	r := NewRouter(s)
+
+	route, err := r.Route([]byte{5})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Route{
+		Partition: 1,
+		Node:      NodeInfo{Name: "node02", Addr: "address02", Weight: 3},
+	}, route)
+
+	route, err = r.Route([]byte{4})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, route.Local)
+
+	addr, err := r.Addr([]byte{8})
+	assert.Equal(t, "address01", addr)
+	assert.Equal(t, nil, err)
+
+	route, err = r.Route([]byte{3})
+	assert.Equal(t, ErrPartitionNotHeld, err)
+	assert.Equal(t, Route{Partition: 3}, route)
+
+	addr, err = r.Addr([]byte{3})
+	assert.Equal(t, "", addr)
+	assert.Equal(t, ErrPartitionNotHeld, err)
+}
@@ -0,0 +1,115 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PartitionInfo ...
+type PartitionInfo struct {
+	ID    PartitionID
+	Epoch Epoch
+
+	// Checkpoint is the checkpoint loaded from the checkpoint store when the partition is started
+	Checkpoint Checkpoint
+}
+
+// PartitionRunnerV2 runs partitions with blocking calls, each call is made on its own goroutine.
+// The context of Start is cancelled when the partition is allocated to another node while starting.
+// A failed Start or Stop is retried with exponential backoff
+type PartitionRunnerV2 interface {
+	Start(ctx context.Context, info PartitionInfo) error
+	Stop(ctx context.Context, info PartitionInfo) error
+}
+
+// coreRunner is the common form of PartitionRunner and PartitionRunnerV2 used by the core service
+type coreRunner interface {
+	start(ctx context.Context, info PartitionInfo, completed func(err error))
+	stop(ctx context.Context, info PartitionInfo, completed func(err error))
+
+	// replicaRunner returns nil when the runner can not keep standbys
+	replicaRunner() ReplicaRunner
+}
+
+type callbackRunner struct {
+	runner PartitionRunner
+}
+
+type blockingRunner struct {
+	runner PartitionRunnerV2
+	store  CheckpointStore
+}
+
+func newCallbackRunner(runner PartitionRunner) coreRunner {
+	return callbackRunner{runner: runner}
+}
+
+func newBlockingRunner(runner PartitionRunnerV2, store CheckpointStore) coreRunner {
+	return blockingRunner{runner: runner, store: store}
+}
+
+func (r callbackRunner) start(_ context.Context, info PartitionInfo, completed func(err error)) {
+	r.runner.Start(info.ID, info.Epoch, func() {
+		completed(nil)
+	})
+}
+
+func (r callbackRunner) stop(_ context.Context, info PartitionInfo, completed func(err error)) {
+	r.runner.Stop(info.ID, func() {
+		completed(nil)
+	})
+}
+
+func (r callbackRunner) replicaRunner() ReplicaRunner {
+	replicaRunner, ok := r.runner.(ReplicaRunner)
+	if !ok {
+		return nil
+	}
+	return replicaRunner
+}
+
+func (r blockingRunner) start(ctx context.Context, info PartitionInfo, completed func(err error)) {
+	go func() {
+		if err := loadCheckpoint(ctx, r.store, &info); err != nil {
+			completed(err)
+			return
+		}
+		completed(r.runner.Start(ctx, info))
+	}()
+}
+
+func (r blockingRunner) stop(ctx context.Context, info PartitionInfo, completed func(err error)) {
+	go func() {
+		if err := r.runner.Stop(ctx, info); err != nil {
+			completed(err)
+			return
+		}
+		err := saveCheckpoint(ctx, r.store, r.runner, info)
+		if errors.Is(err, ErrStaleCheckpoint) {
+			// a newer holder has already saved its checkpoint, e.g. after a forced handoff,
+			// this run is fenced and saving again would never succeed
+			err = nil
+		}
+		completed(err)
+	}()
+}
+
+func (blockingRunner) replicaRunner() ReplicaRunner {
+	return nil
+}
+
+// computeBackoff doubles the min delay for each consecutive failure, up to the max delay
+func computeBackoff(minDelay time.Duration, maxDelay time.Duration, failures int) time.Duration {
+	delay := minDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
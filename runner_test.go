@@ -0,0 +1,134 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComputeBackoff(t *testing.T) {
+	minDelay := 100 * time.Millisecond
+	maxDelay := time.Second
+
+	assert.Equal(t, 100*time.Millisecond, computeBackoff(minDelay, maxDelay, 1))
+	assert.Equal(t, 200*time.Millisecond, computeBackoff(minDelay, maxDelay, 2))
+	assert.Equal(t, 800*time.Millisecond, computeBackoff(minDelay, maxDelay, 4))
+	assert.Equal(t, time.Second, computeBackoff(minDelay, maxDelay, 5))
+	assert.Equal(t, time.Second, computeBackoff(minDelay, maxDelay, 100))
+	assert.Equal(t, time.Second, computeBackoff(2*time.Second, maxDelay, 1))
+}
+
+type testRunnerV2 struct {
+	mut       sync.Mutex
+	starts    map[PartitionID][]Epoch
+	contexts  map[PartitionID]context.Context
+	cancelled map[PartitionID]int
+
+	start func(ctx context.Context, info PartitionInfo) error
+}
+
+func newTestRunnerV2() *testRunnerV2 {
+	return &testRunnerV2{
+		starts:    map[PartitionID][]Epoch{},
+		contexts:  map[PartitionID]context.Context{},
+		cancelled: map[PartitionID]int{},
+	}
+}
+
+func (r *testRunnerV2) Start(ctx context.Context, info PartitionInfo) error {
+	r.mut.Lock()
+	r.starts[info.ID] = append(r.starts[info.ID], info.Epoch)
+	r.contexts[info.ID] = ctx
+	r.mut.Unlock()
+
+	err := r.start(ctx, info)
+	if errors.Is(err, context.Canceled) {
+		r.mut.Lock()
+		r.cancelled[info.ID]++
+		r.mut.Unlock()
+	}
+	return err
+}
+
+func (r *testRunnerV2) Stop(context.Context, PartitionInfo) error {
+	return nil
+}
+
+func (r *testRunnerV2) startCount(id PartitionID) int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return len(r.starts[id])
+}
+
+func (r *testRunnerV2) startContext(id PartitionID) context.Context {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.contexts[id]
+}
+
+func (r *testRunnerV2) cancelCount(id PartitionID) int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.cancelled[id]
+}
+
+func TestServiceV2_Start_Failed__Retried(t *testing.T) {
+	runner := newTestRunnerV2()
+
+	var mut sync.Mutex
+	failures := 0
+	runner.start = func(ctx context.Context, info PartitionInfo) error {
+		mut.Lock()
+		defer mut.Unlock()
+		if failures < 2 {
+			failures++
+			return errors.New("start failed")
+		}
+		return nil
+	}
+
+	s := NewV2(1, "node01", "address01", runner, WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	s.Start()
+	defer shutdownService(t, s)
+
+	assert.Eventually(t, func() bool {
+		return s.CurrentEpoch(0) == Epoch{Incarnation: 1, Node: "node01"}
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 3, runner.startCount(0))
+}
+
+func TestServiceV2_Reallocated_While_Starting__Context_Cancelled(t *testing.T) {
+	runner := newTestRunnerV2()
+	runner.start = func(ctx context.Context, info PartitionInfo) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s := NewV2(2, "node01", "address01", runner)
+	s.Start()
+	defer shutdownService(t, s)
+
+	assert.Eventually(t, func() bool {
+		return runner.startCount(0) == 1 && runner.startCount(1) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	s.NotifyJoin("node02", "address02", nil)
+
+	assert.Eventually(t, func() bool {
+		return runner.cancelCount(1) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// both partitions are reallocated at once, so the start of partition 0 would be cancelled by now
+	assert.Equal(t, nil, runner.startContext(0).Err())
+
+	assert.Eventually(t, func() bool {
+		s.core.mut.Lock()
+		defer s.core.mut.Unlock()
+		state := s.core.partitions[1].state
+		return state.status == partitionStatusStopped && state.owner == "node02"
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 1, runner.startCount(1))
+}
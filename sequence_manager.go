@@ -4,13 +4,32 @@ type sequenceManager struct {
 	first     uint64
 	last      uint64
 	sequences []bool
+
+	// maxSize is the size up to which the window grows, the window has a fixed size when it is not larger than size
+	maxSize int
+	// overflows counts the uncompleted sequences considered completed because they fell out of the window
+	overflows uint64
 }
 
 func newSequenceManager(size int) *sequenceManager {
+	return newGrowingSequenceManager(size, size)
+}
+
+// newGrowingSequenceManager creates a sequence manager whose window doubles when a sequence is completed
+// beyond it, up to maxSize. Only after that the oldest uncompleted sequences are considered completed.
+// The window holds at least one sequence
+func newGrowingSequenceManager(size int, maxSize int) *sequenceManager {
+	if size < 1 {
+		size = 1
+	}
+	if maxSize < size {
+		maxSize = size
+	}
 	return &sequenceManager{
 		first:     1,
 		last:      1,
 		sequences: make([]bool, size),
+		maxSize:   maxSize,
 	}
 }
 
@@ -33,20 +52,28 @@ func (m *sequenceManager) clear(seq uint64) {
 	m.sequences[index] = false
 }
 
+// clearTo clears the slots of the sequences from first to before to, at most the whole window
 func (m *sequenceManager) clearTo(to uint64) {
-	seq := m.first
-	for ; seq < to; seq++ {
+	end := m.first + m.size()
+	if to < end {
+		end = to
+	}
+	for seq := m.first; seq < end; seq++ {
 		m.clear(seq)
 	}
 }
 
+// clearAndSetFirst moves the window to the first uncompleted sequence. When last is beyond the window,
+// the sequences before the new window are dropped first, the work is bounded by the window size however far last is
 func (m *sequenceManager) clearAndSetFirst() {
-	from := m.first
 	if m.last > m.first+m.size() {
-		from = m.last - m.size()
+		from := m.last - m.size()
+		m.overflows += m.uncompletedBefore(from)
+		m.clearTo(from)
+		m.first = from
 	}
 
-	seq := from
+	seq := m.first
 	for ; seq < m.last; seq++ {
 		if m.sequences[seq%m.size()] == false {
 			break
@@ -57,7 +84,49 @@ func (m *sequenceManager) clearAndSetFirst() {
 	m.first = seq
 }
 
+// uncompletedBefore counts the uncompleted sequences from first to seq, only the ones of the window are tracked,
+// the sequences after the window are never completed
+func (m *sequenceManager) uncompletedBefore(seq uint64) uint64 {
+	end := m.first + m.size()
+	if seq < end {
+		end = seq
+	}
+
+	var count uint64
+	for s := m.first; s < end; s++ {
+		if !m.sequences[s%m.size()] {
+			count++
+		}
+	}
+	return count + (seq - end)
+}
+
+func (m *sequenceManager) grow() {
+	newSize := 2 * len(m.sequences)
+	if newSize == 0 {
+		newSize = 1
+	}
+	if newSize > m.maxSize {
+		newSize = m.maxSize
+	}
+
+	sequences := make([]bool, newSize)
+	for seq := m.first; seq < m.last; seq++ {
+		sequences[seq%uint64(newSize)] = m.sequences[seq%m.size()]
+	}
+	m.sequences = sequences
+}
+
+// setCompleted ignores the sequences already before the window, their slots belong to newer sequences
 func (m *sequenceManager) setCompleted(seq uint64) {
+	if seq < m.first {
+		return
+	}
+
+	for seq >= m.first+m.size() && len(m.sequences) < m.maxSize {
+		m.grow()
+	}
+
 	if m.last <= seq {
 		m.last = seq + 1
 	}
@@ -78,3 +147,7 @@ func (m *sequenceManager) setAllCompleted(seq uint64) {
 func (m *sequenceManager) uncompletedFrom() uint64 {
 	return m.first
 }
+
+func (m *sequenceManager) overflowCount() uint64 {
+	return m.overflows
+}
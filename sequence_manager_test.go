@@ -201,3 +201,62 @@ func TestSequenceManager_SetAllCompleted(t *testing.T) {
 
 	assert.Equal(t, uint64(7), m.uncompletedFrom())
 }
+
+func TestSequenceManager_Exceed_Size__Overflow_Counted(t *testing.T) {
+	m := newSequenceManager(4)
+
+	m.setCompleted(2)
+	m.setCompleted(6)
+	assert.Equal(t, uint64(3), m.uncompletedFrom())
+	assert.Equal(t, uint64(1), m.overflowCount())
+
+	m.setCompleted(9)
+	assert.Equal(t, uint64(7), m.uncompletedFrom())
+	assert.Equal(t, uint64(4), m.overflowCount())
+}
+
+func TestSequenceManager_Exceed_Size_By_Many_Windows__Overflow_Counted(t *testing.T) {
+	m := newSequenceManager(4)
+
+	m.setCompleted(3)
+	m.setCompleted(100)
+	assert.Equal(t, uint64(97), m.uncompletedFrom())
+	assert.Equal(t, uint64(95), m.overflowCount())
+	assert.Equal(t, true, m.completed(100))
+}
+
+func TestSequenceManager_Exceed_Size_By_Many_Windows__Older_Slots_Cleared(t *testing.T) {
+	m := newSequenceManager(4)
+
+	m.setCompleted(3)
+	m.setCompleted(102)
+	assert.Equal(t, uint64(99), m.uncompletedFrom())
+	assert.Equal(t, false, m.completed(99))
+	assert.Equal(t, uint64(97), m.overflowCount())
+}
+
+func TestSequenceManager_Growing(t *testing.T) {
+	m := newGrowingSequenceManager(2, 8)
+
+	m.setCompleted(2)
+	m.setCompleted(6)
+	assert.Equal(t, 8, len(m.sequences))
+	assert.Equal(t, false, m.completed(1))
+	assert.Equal(t, true, m.completed(2))
+	assert.Equal(t, false, m.completed(3))
+	assert.Equal(t, true, m.completed(6))
+	assert.Equal(t, uint64(1), m.uncompletedFrom())
+	assert.Equal(t, uint64(0), m.overflowCount())
+
+	m.setCompleted(1)
+	assert.Equal(t, uint64(3), m.uncompletedFrom())
+
+	// the window does not grow beyond the max size
+	m.setCompleted(12)
+	assert.Equal(t, 8, len(m.sequences))
+	assert.Equal(t, uint64(5), m.uncompletedFrom())
+	assert.Equal(t, uint64(2), m.overflowCount())
+	assert.Equal(t, true, m.completed(6))
+	assert.Equal(t, false, m.completed(7))
+	assert.Equal(t, true, m.completed(12))
+}
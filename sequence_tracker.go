@@ -0,0 +1,161 @@
+package shim
+
+import "sync"
+
+const sequenceTrackerVersion uint8 = 1
+
+// SequenceTracker tracks sequence numbers completed out of order, e.g. the offsets of messages
+// of a partition processed concurrently, its watermark is the highest sequence number such that
+// it and all the ones before it are completed. Sequence numbers start from 1. It is safe for concurrent use
+type SequenceTracker struct {
+	mut  sync.Mutex
+	seqs *sequenceManager
+
+	onAdvance func(watermark uint64)
+}
+
+// NewSequenceTracker creates a tracker with a window of size sequence numbers after the watermark,
+// it doubles when a sequence number beyond it is completed, up to maxSize.
+// After that the oldest uncompleted sequence numbers are considered completed and counted by Overflows.
+// A size less than 1 is considered 1
+func NewSequenceTracker(size int, maxSize int) *SequenceTracker {
+	return &SequenceTracker{
+		seqs: newGrowingSequenceManager(size, maxSize),
+	}
+}
+
+// OnAdvance sets the function called with the new watermark every time it advances,
+// it is called while holding the lock of the tracker, so it must not call the tracker
+func (t *SequenceTracker) OnAdvance(fn func(watermark uint64)) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.onAdvance = fn
+}
+
+// Complete marks the sequence number completed
+func (t *SequenceTracker) Complete(seq uint64) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if seq == 0 {
+		return
+	}
+
+	prev := t.seqs.uncompletedFrom()
+	t.seqs.setCompleted(seq)
+	t.advanced(prev)
+}
+
+// Completed returns true when the sequence number is completed or is not after the watermark
+func (t *SequenceTracker) Completed(seq uint64) bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return t.seqs.completed(seq)
+}
+
+// Watermark returns the highest completed sequence number with all the ones before it completed,
+// zero when sequence number 1 is not completed yet
+func (t *SequenceTracker) Watermark() uint64 {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return t.seqs.uncompletedFrom() - 1
+}
+
+// Reset considers all sequence numbers up to the watermark completed and the ones after it uncompleted,
+// e.g. to resume from an offset committed elsewhere
+func (t *SequenceTracker) Reset(watermark uint64) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	prev := t.seqs.uncompletedFrom()
+	t.seqs.setAllCompleted(watermark)
+	t.advanced(prev)
+}
+
+// Overflows returns the number of uncompleted sequence numbers considered completed because they fell out of the window
+func (t *SequenceTracker) Overflows() uint64 {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return t.seqs.overflowCount()
+}
+
+func (t *SequenceTracker) advanced(prev uint64) {
+	from := t.seqs.uncompletedFrom()
+	if from == prev || t.onAdvance == nil {
+		return
+	}
+	t.onAdvance(from - 1)
+}
+
+// MarshalBinary encodes the watermark and the sequence numbers completed after it,
+// so that a runner can checkpoint the tracker and resume on another node
+func (t *SequenceTracker) MarshalBinary() ([]byte, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	m := t.seqs
+	data := []byte{sequenceTrackerVersion}
+	data = appendUvarint(data, m.uncompletedFrom()-1)
+
+	var completed []uint64
+	for seq := m.uncompletedFrom(); seq < m.last; seq++ {
+		if m.completed(seq) {
+			completed = append(completed, seq)
+		}
+	}
+
+	// each completed sequence number is encoded as the distance from the previous one
+	data = appendUvarint(data, uint64(len(completed)))
+	prev := m.uncompletedFrom() - 1
+	for _, seq := range completed {
+		data = appendUvarint(data, seq-prev)
+		prev = seq
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores a tracker encoded by MarshalBinary, the window and the callback are kept.
+// The callback is not called
+func (t *SequenceTracker) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errInvalidMessage
+	}
+	if data[0] != sequenceTrackerVersion {
+		return errUnsupportedVersion
+	}
+
+	d := &messageDecoder{data: data[1:]}
+	watermark := d.uvarint()
+
+	count := d.uvarint()
+	if count > uint64(len(d.data)) {
+		return errInvalidMessage
+	}
+
+	completed := make([]uint64, 0, count)
+	seq := watermark
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		delta := d.uvarint()
+		if delta == 0 || seq+delta < seq {
+			d.err = errInvalidMessage
+		}
+		seq += delta
+		completed = append(completed, seq)
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.seqs.setAllCompleted(watermark)
+	for _, seq := range completed {
+		t.seqs.setCompleted(seq)
+	}
+	return nil
+}
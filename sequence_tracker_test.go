@@ -0,0 +1,124 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSequenceTracker_Watermark_And_OnAdvance(t *testing.T) {
+	tracker := NewSequenceTracker(4, 16)
+
+	var watermarks []uint64
+	tracker.OnAdvance(func(watermark uint64) {
+		watermarks = append(watermarks, watermark)
+	})
+
+	assert.Equal(t, uint64(0), tracker.Watermark())
+
+	tracker.Complete(2)
+	tracker.Complete(3)
+	assert.Equal(t, uint64(0), tracker.Watermark())
+	assert.Equal(t, true, tracker.Completed(3))
+	assert.Equal(t, false, tracker.Completed(1))
+
+	tracker.Complete(1)
+	assert.Equal(t, uint64(3), tracker.Watermark())
+
+	tracker.Complete(4)
+	tracker.Complete(4)
+	tracker.Complete(0)
+	assert.Equal(t, uint64(4), tracker.Watermark())
+
+	tracker.Reset(100)
+	assert.Equal(t, uint64(100), tracker.Watermark())
+
+	assert.Equal(t, []uint64{3, 4, 100}, watermarks)
+	assert.Equal(t, uint64(0), tracker.Overflows())
+}
+
+func TestSequenceTracker_Redelivered_Before_Watermark__Ignored(t *testing.T) {
+	tracker := NewSequenceTracker(4, 4)
+	tracker.Reset(4)
+
+	tracker.Complete(2)
+	tracker.Complete(5)
+	tracker.Complete(7)
+
+	assert.Equal(t, uint64(5), tracker.Watermark())
+	assert.Equal(t, false, tracker.Completed(6))
+	assert.Equal(t, true, tracker.Completed(7))
+}
+
+func TestSequenceTracker_Zero_Size(t *testing.T) {
+	tracker := NewSequenceTracker(0, 0)
+
+	tracker.Complete(2)
+	tracker.Complete(1)
+	assert.Equal(t, uint64(2), tracker.Watermark())
+}
+
+func TestSequenceTracker_Complete_Far_Ahead__Bounded_By_Window(t *testing.T) {
+	tracker := NewSequenceTracker(64, 1024)
+	tracker.Complete(2)
+
+	start := time.Now()
+	tracker.Complete(200_000_000)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Equal(t, uint64(200_000_000-1024), tracker.Watermark())
+	assert.Equal(t, uint64(200_000_000-1024-1), tracker.Overflows())
+	assert.Equal(t, true, tracker.Completed(200_000_000))
+	assert.Equal(t, false, tracker.Completed(200_000_000-1))
+}
+
+func TestSequenceTracker_Concurrent_Complete(t *testing.T) {
+	tracker := NewSequenceTracker(64, 1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for seq := uint64(i + 1); seq <= 800; seq += 8 {
+				tracker.Complete(seq)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(800), tracker.Watermark())
+}
+
+func TestSequenceTracker_Marshal_Unmarshal(t *testing.T) {
+	tracker := NewSequenceTracker(4, 16)
+	tracker.Complete(1)
+	tracker.Complete(2)
+	tracker.Complete(4)
+	tracker.Complete(9)
+
+	data, err := tracker.MarshalBinary()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{sequenceTrackerVersion, 2, 2, 2, 5}, data)
+
+	result := NewSequenceTracker(4, 16)
+	assert.Equal(t, nil, result.UnmarshalBinary(data))
+	assert.Equal(t, uint64(2), result.Watermark())
+	assert.Equal(t, false, result.Completed(3))
+	assert.Equal(t, true, result.Completed(4))
+	assert.Equal(t, true, result.Completed(9))
+
+	result.Complete(3)
+	assert.Equal(t, uint64(4), result.Watermark())
+}
+
+func TestSequenceTracker_Unmarshal_Invalid(t *testing.T) {
+	tracker := NewSequenceTracker(4, 4)
+
+	assert.Equal(t, errInvalidMessage, tracker.UnmarshalBinary(nil))
+	assert.Equal(t, errUnsupportedVersion, tracker.UnmarshalBinary([]byte{2, 0, 0}))
+	assert.Equal(t, errInvalidMessage, tracker.UnmarshalBinary([]byte{sequenceTrackerVersion, 2, 1}))
+	assert.Equal(t, errInvalidMessage, tracker.UnmarshalBinary([]byte{sequenceTrackerVersion, 2, 1, 0}))
+	assert.Equal(t, errInvalidMessage, tracker.UnmarshalBinary([]byte{sequenceTrackerVersion, 2, 0, 1}))
+}
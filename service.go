@@ -0,0 +1,471 @@
+package shim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Service ...
+type Service struct {
+	selfNode string
+	selfAddr string
+	options  serviceOptions
+
+	core    *coreService
+	joinMgr *nodeJoinManager
+	events  *eventDispatcher
+	acked   *ackedBroadcaster
+
+	mut       sync.Mutex
+	closed    bool
+	left      bool
+	joinTimer Timer
+	waiters   []func()
+
+	// joinGen is incremented when the join loop is restarted, a join of an older generation does not run.
+	// joinRestart is set when the loop is restarted while joinRunning, the join then runs again once completed
+	joinGen     uint64
+	joinRunning bool
+	joinRestart bool
+
+	joinFailures int
+	joinRand     *rand.Rand
+
+	discovered     bool
+	discoveryTimer Timer
+}
+
+var _ nodeBroadcaster = &Service{}
+var _ partitionBroadcaster = &Service{}
+
+// New creates a service running partitionCount partitions, it panics when partitionCount is not positive
+func New(
+	partitionCount int, selfNode string, selfAddr string,
+	runner PartitionRunner, opts ...Option,
+) *Service {
+	return newService(partitionCount, selfNode, selfAddr, func(serviceOptions) coreRunner {
+		return newCallbackRunner(runner)
+	}, opts...)
+}
+
+// NewV2 creates a service with a PartitionRunnerV2, with a checkpoint store the checkpoint of a partition
+// is passed to Start and saved after Stop when the runner is a CheckpointRunner.
+// It panics when partitionCount is not positive
+func NewV2(
+	partitionCount int, selfNode string, selfAddr string,
+	runner PartitionRunnerV2, opts ...Option,
+) *Service {
+	return newService(partitionCount, selfNode, selfAddr, func(options serviceOptions) coreRunner {
+		return newBlockingRunner(runner, options.checkpointStore)
+	}, opts...)
+}
+
+func newService(
+	partitionCount int, selfNode string, selfAddr string,
+	newRunner func(options serviceOptions) coreRunner, opts ...Option,
+) *Service {
+	if partitionCount <= 0 {
+		panic(fmt.Sprintf("shim: invalid partition count %d", partitionCount))
+	}
+
+	options := computeOptions(opts...)
+	runner := newRunner(options)
+
+	s := &Service{
+		selfNode: selfNode,
+		selfAddr: selfAddr,
+		options:  options,
+
+		// seeded by the node name, so that nodes retry at different times but a simulation is reproducible
+		joinRand: rand.New(rand.NewSource(int64(fnvKeyHash([]byte(selfNode))))),
+	}
+	s.events = newEventDispatcher()
+	if options.ackInterval > 0 && options.nodeDelegate != nil {
+		s.acked = newAckedBroadcaster(
+			selfNode, options.nodeDelegate.Broadcast,
+			options.clock, options.ackInterval, options.ackWindowSize,
+		)
+	}
+	s.core = newCoreService(partitionCount, selfNode, selfAddr, runner, s, s.events, options)
+	s.joinMgr = newNodeJoinManager(selfNode, selfAddr, s.core, s, s.events, options)
+	return s
+}
+
+// Start ...
+func (s *Service) Start() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.options.dnsDiscovery != nil {
+		s.discoveryTimer = s.options.clock.NewTimer(0, s.discover)
+		return
+	}
+	s.scheduleJoin(0)
+}
+
+// Shutdown leaves the cluster gracefully: it announces the leave, so that other nodes stop allocating partitions
+// to this node, stops all partitions and waits for their stop messages to be broadcast, then leaves the cluster.
+// Other nodes take the partitions over as soon as they are stopped.
+// When ctx is done before all partitions are stopped, the node leaves immediately and a *ShutdownError is returned.
+// The partitions not stopped yet keep running on this node while other nodes start them,
+// so their runners must rely on the epoch fencing to reject the writes of this node
+func (s *Service) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	s.StartShutdown(func() {
+		close(done)
+	})
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		abandoned := s.core.notStopped()
+		s.leave()
+		return &ShutdownError{Abandoned: abandoned, Err: ctx.Err()}
+	}
+}
+
+// ShutdownError is returned by Shutdown when its context is done before all partitions are stopped,
+// Abandoned are the partitions still running or being started or stopped when the node left
+type ShutdownError struct {
+	Abandoned []PartitionID
+	Err       error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shim: left with partitions %v not stopped: %v", e.Abandoned, e.Err)
+}
+
+// Unwrap returns the error of the context
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// StartShutdown begins the graceful shutdown of Shutdown without waiting,
+// completed is called after the node has left the cluster
+func (s *Service) StartShutdown(completed func()) {
+	s.mut.Lock()
+	if s.left {
+		s.mut.Unlock()
+		completed()
+		return
+	}
+
+	s.waiters = append(s.waiters, completed)
+	if s.closed {
+		s.mut.Unlock()
+		return
+	}
+
+	s.closed = true
+	if s.joinTimer != nil {
+		s.joinTimer.Stop()
+	}
+	if s.discoveryTimer != nil {
+		s.discoveryTimer.Stop()
+	}
+	s.mut.Unlock()
+
+	s.broadcast(nodeLeftMsg{name: s.selfNode, addr: s.selfAddr})
+	s.core.shutdown(s.leave)
+}
+
+func (s *Service) leave() {
+	s.mut.Lock()
+	if s.left {
+		s.mut.Unlock()
+		return
+	}
+	s.left = true
+	waiters := s.waiters
+	s.waiters = nil
+	s.mut.Unlock()
+
+	if s.acked != nil {
+		s.acked.stop()
+	}
+	s.core.close()
+	if s.options.nodeDelegate != nil {
+		s.options.nodeDelegate.Leave()
+	}
+	s.events.close()
+
+	for _, completed := range waiters {
+		completed()
+	}
+}
+
+// NodeMeta returns the metadata of this node, the membership layer must pass it to NotifyJoin of other nodes
+func (s *Service) NodeMeta() []byte {
+	return s.options.nodeMeta().Marshal()
+}
+
+// NotifyJoin is called by the membership layer when a node joins the cluster or its metadata is updated
+func (s *Service) NotifyJoin(name string, addr string, meta []byte) {
+	if name == s.selfNode {
+		return
+	}
+
+	var m nodeMeta
+	if len(meta) > 0 {
+		if err := m.Unmarshal(meta); err != nil {
+			m = nodeMeta{}
+		}
+	}
+	if s.acked != nil {
+		s.acked.memberJoined(name)
+	}
+	s.joinMgr.notifyJoin(name, addr, m)
+}
+
+// NotifyLeave is called by the membership layer when a node leaves the cluster
+func (s *Service) NotifyLeave(name string) {
+	if name == s.selfNode {
+		return
+	}
+	if s.acked != nil {
+		s.acked.memberLeft(name)
+	}
+	s.joinMgr.notifyLeave(name)
+}
+
+// scheduleJoin runs the next join of the current join loop after the delay
+func (s *Service) scheduleJoin(delay time.Duration) {
+	gen := s.joinGen
+	s.joinTimer = s.options.clock.NewTimer(delay, func() {
+		s.join(gen)
+	})
+}
+
+// restartJoin replaces the join loop by a new one joining immediately,
+// after the join in progress when there is one
+func (s *Service) restartJoin() {
+	if s.joinTimer != nil {
+		s.joinTimer.Stop()
+	}
+	s.joinGen++
+	if s.joinRunning {
+		s.joinRestart = true
+		return
+	}
+	s.scheduleJoin(0)
+}
+
+// join joins the static addresses that are not members, it is run periodically so that
+// a node split from the static addresses joins them again after the network is healed.
+// The mutex is not held while joining, so that shutting down is not delayed by unreachable addresses
+func (s *Service) join(gen uint64) {
+	s.mut.Lock()
+	if s.closed || gen != s.joinGen {
+		s.mut.Unlock()
+		return
+	}
+	s.joinRunning = true
+	s.mut.Unlock()
+
+	var err error
+	addrs, version := s.joinMgr.needJoin()
+	if len(addrs) > 0 && s.options.nodeDelegate != nil {
+		err = s.options.nodeDelegate.Join(addrs)
+	}
+	// partitions are allocated even when joining failed, members are still discovered through gossip
+	s.joinMgr.joinCompleted()
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.joinRunning = false
+	if s.closed {
+		return
+	}
+
+	delay, ok := s.nextJoinDelay(err, s.joinMgr.changedSince(version))
+	if s.joinRestart {
+		s.joinRestart = false
+		delay, ok = 0, true
+	}
+	if !ok {
+		return
+	}
+	s.scheduleJoin(delay)
+}
+
+// nextJoinDelay returns the delay before the next join, with exponential backoff and jitter after failures.
+// It returns false when joining periodically is disabled
+func (s *Service) nextJoinDelay(err error, changed bool) (time.Duration, bool) {
+	if err != nil {
+		s.joinFailures++
+		delay := computeBackoff(s.options.joinMinDelay, s.options.joinMaxDelay, s.joinFailures)
+		half := int64(delay / 2)
+		return time.Duration(half + s.joinRand.Int63n(half+1)), true
+	}
+	s.joinFailures = 0
+
+	if changed {
+		return 0, true
+	}
+	if s.options.rejoinInterval <= 0 {
+		return 0, false
+	}
+	return s.options.rejoinInterval, true
+}
+
+// NotifyMsg is called by the membership layer when a broadcast message is received
+func (s *Service) NotifyMsg(msg []byte) {
+	msgType, _, err := parseMessageHeader(msg)
+	if err != nil {
+		return
+	}
+
+	switch msgType {
+	case messageTypePartitions:
+		var batch partitionBatch
+		if err := batch.Unmarshal(msg); err != nil {
+			return
+		}
+		s.core.recvPartitionMsgs(batch)
+
+	case messageTypeNodeLeft:
+		var leftMsg nodeLeftMsg
+		if err := leftMsg.Unmarshal(msg); err != nil {
+			return
+		}
+		s.joinMgr.notifyMsg(leftMsg)
+
+	case messageTypeSequencedPartitions:
+		var sequenced sequencedPartitions
+		if err := sequenced.Unmarshal(msg); err != nil {
+			return
+		}
+		s.core.recvPartitionMsgs(sequenced.batch)
+		s.ack(sequenced)
+
+	case messageTypeUnhealthyPartitions:
+		var unhealthy unhealthyPartitions
+		if err := unhealthy.Unmarshal(msg); err != nil {
+			return
+		}
+		s.core.recvPartitionMsgs(unhealthy)
+
+	case messageTypePartitionsAck:
+		var ack partitionsAck
+		if err := ack.Unmarshal(msg); err != nil {
+			return
+		}
+		if s.acked != nil {
+			s.acked.recvAck(ack)
+		}
+
+	default:
+	}
+}
+
+// Lookup returns the node currently holding the partition,
+// false when no member is known to hold it, e.g. while it is moved between nodes
+func (s *Service) Lookup(partition PartitionID) (NodeInfo, bool) {
+	if int(partition) >= s.core.partitionCount {
+		return NodeInfo{}, false
+	}
+	return s.core.lookup(partition)
+}
+
+// PartitionOf returns the partition of the key, computed by the key hash function of the service
+func (s *Service) PartitionOf(key []byte) PartitionID {
+	return PartitionID(s.options.keyHash(key) % uint64(s.core.partitionCount))
+}
+
+// CurrentEpoch returns the newest known epoch of the partition, an empty epoch when it has never been run.
+// Storage written by runners can reject writes fenced by an epoch less than it
+func (s *Service) CurrentEpoch(partition PartitionID) Epoch {
+	if int(partition) >= s.core.partitionCount {
+		return Epoch{}
+	}
+	return s.core.currentEpoch(partition)
+}
+
+// ReportUnhealthy releases the partition when this node is running it, e.g. its runner is stuck
+// although the node is still alive. The partition is stopped and allocated to another node,
+// it is restarted on this node only when no other node can take it.
+// Nodes of older versions ignore that the partition is unhealthy, they only see it left and may allocate it back.
+// It returns false when this node is not running the partition
+func (s *Service) ReportUnhealthy(partition PartitionID) bool {
+	if int(partition) >= s.core.partitionCount {
+		return false
+	}
+	return s.core.reportUnhealthy(partition)
+}
+
+// Subscribe registers a handler of ownership and membership events, it returns a function to unsubscribe.
+// Handlers are called in order on a dedicated goroutine, a slow handler delays the next events.
+// No event is published after the node has left the cluster
+func (s *Service) Subscribe(handler func(e Event)) (unsubscribe func()) {
+	return s.events.subscribe(handler)
+}
+
+// Stats returns the counters of the service, e.g. the number of stuck starts and stops
+func (s *Service) Stats() Stats {
+	stats := s.core.getStats()
+	if s.acked != nil {
+		s.acked.addStats(&stats)
+	}
+	return stats
+}
+
+// LocalState returns a snapshot of the state of all partitions,
+// it is sent to other nodes periodically and on join for anti-entropy
+func (s *Service) LocalState() []byte {
+	return partitionSnapshot(s.core.snapshot()).Marshal()
+}
+
+// MergeRemoteState merges a snapshot returned by LocalState of another node
+func (s *Service) MergeRemoteState(state []byte) {
+	var snapshot partitionSnapshot
+	if err := snapshot.Unmarshal(state); err != nil {
+		return
+	}
+	s.core.recvPartitionMsgs(snapshot)
+}
+
+func (s *Service) broadcast(msg nodeLeftMsg) {
+	if s.options.nodeDelegate == nil {
+		return
+	}
+	s.options.nodeDelegate.Broadcast(msg.Marshal())
+}
+
+func (s *Service) broadcastPartitions(entries []partitionEntry) {
+	if s.options.nodeDelegate == nil {
+		return
+	}
+	for _, data := range batchPartitionEntries(entries, s.options.maxMessageSize) {
+		if s.acked != nil {
+			s.acked.broadcast(data)
+			continue
+		}
+		s.options.nodeDelegate.Broadcast(data)
+	}
+
+	// the partitions released as unhealthy are announced after their left messages, it is only a hint for the allocation
+	var unhealthy []partitionEntry
+	for _, e := range entries {
+		if e.msg.left && e.msg.unhealthy {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	for _, data := range batchEntries(messageTypeUnhealthyPartitions, unhealthy, s.options.maxMessageSize) {
+		s.options.nodeDelegate.Broadcast(data)
+	}
+}
+
+// ack acknowledges sequenced partitions to their sender, acks are broadcast
+// because the membership layer has no direct messages, other nodes ignore them
+func (s *Service) ack(msg sequencedPartitions) {
+	if s.options.nodeDelegate == nil || msg.sender == s.selfNode {
+		return
+	}
+	ack := partitionsAck{from: s.selfNode, to: msg.sender, seqs: []uint64{msg.seq}}
+	s.options.nodeDelegate.Broadcast(ack.Marshal())
+}
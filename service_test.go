@@ -0,0 +1,431 @@
+package shim
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func shutdownService(t *testing.T, s *Service) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Equal(t, nil, s.Shutdown(ctx))
+}
+
+func TestService_Start_Single_Node__Run_All_Partitions(t *testing.T) {
+	var mut sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	started := map[PartitionID]bool{}
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			mut.Lock()
+			started[partition] = true
+			mut.Unlock()
+
+			startCompleted()
+			wg.Done()
+		},
+		StopFunc: func(partition PartitionID, stopCompleted func()) {
+			stopCompleted()
+		},
+	}
+
+	s := New(3, "node01", "address01", runner)
+	s.Start()
+	wg.Wait()
+	shutdownService(t, s)
+
+	assert.Equal(t, map[PartitionID]bool{0: true, 1: true, 2: true}, started)
+}
+
+func TestService_Start_Join_Static_Addresses(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+		StopFunc: func(partition PartitionID, stopCompleted func()) {
+			stopCompleted()
+		},
+	}
+	delegate := &NodeDelegateMock{
+		JoinFunc:      func(addrs []string) error { return nil },
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "address01", runner,
+		WithStaticAddresses([]string{"address01", "address02"}),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+	)
+	s.Start()
+	clock.advance(0)
+	shutdownService(t, s)
+
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+	assert.Equal(t, []string{"address02"}, delegate.JoinCalls()[0].Addrs)
+	assert.Equal(t, 1, len(delegate.LeaveCalls()))
+	assert.Equal(t, 2, len(runner.StartCalls()))
+}
+
+func TestService_NotifyMsg__Update_Partition_State(t *testing.T) {
+	runner := &PartitionRunnerMock{}
+	s := New(4, "node01", "address01", runner)
+
+	s.NotifyMsg(partitionBatch{
+		{id: 2, msg: partitionMsg{incarnation: 3, current: "node02"}},
+	}.Marshal())
+
+	assert.Equal(t, partitionState{
+		incarnation: 3,
+		current:     "node02",
+	}, s.core.partitions[2].state)
+}
+
+func TestService_New__Invalid_Partition_Count__Panic(t *testing.T) {
+	assert.PanicsWithValue(t, "shim: invalid partition count 0", func() {
+		New(0, "node01", "address01", &PartitionRunnerMock{})
+	})
+	assert.PanicsWithValue(t, "shim: invalid partition count -1", func() {
+		NewV2(-1, "node01", "address01", newTestRunnerV2())
+	})
+}
+
+func TestService_Complete_Starting__Broadcast_To_Delegate(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+	}
+	delegate := &NodeDelegateMock{
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(1, "node01", "address01", runner, WithNodeDelegate(delegate), WithClock(clock))
+	s.Start()
+	clock.advance(0)
+
+	assert.Equal(t, 1, len(delegate.BroadcastCalls()))
+	assert.Equal(t,
+		partitionBatch{
+			{id: 0, msg: partitionMsg{incarnation: 1, current: "node01"}},
+		}.Marshal(),
+		delegate.BroadcastCalls()[0].Msg,
+	)
+}
+
+func TestService_Report_Unhealthy__Broadcast_Left_Then_Unhealthy(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+		StopFunc: func(partition PartitionID, stopCompleted func()) {
+			stopCompleted()
+		},
+	}
+	delegate := &NodeDelegateMock{
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "address01", runner, WithNodeDelegate(delegate), WithClock(clock))
+	s.Start()
+	clock.advance(0)
+
+	assert.Equal(t, false, s.ReportUnhealthy(2))
+	assert.Equal(t, true, s.ReportUnhealthy(1))
+
+	// the only node restarts the partition after its release
+	calls := delegate.BroadcastCalls()
+	assert.Equal(t, 5, len(calls))
+	assert.Equal(t, partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node01", left: true}},
+	}.Marshal(), calls[2].Msg)
+	assert.Equal(t, unhealthyPartitions{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node01", left: true}},
+	}.Marshal(), calls[3].Msg)
+	assert.Equal(t, partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 2, current: "node01"}},
+	}.Marshal(), calls[4].Msg)
+}
+
+func TestService_Recv_Unhealthy_After_Left__Allocated_To_Other_Node(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {},
+	}
+	s := New(2, "node01", "address01", runner)
+	s.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	s.NotifyMsg(partitionBatch{
+		{id: 0, msg: partitionMsg{incarnation: 1, current: "node01"}},
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	}.Marshal())
+	s.core.onJoinCompleted()
+
+	s.NotifyMsg(partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	}.Marshal())
+	s.NotifyMsg(unhealthyPartitions{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02", left: true}},
+	}.Marshal())
+
+	assert.Equal(t, true, s.core.partitions[1].state.unhealthy)
+	assert.Equal(t, "node01", s.core.partitions[1].state.owner)
+}
+
+func TestService_LocalState_MergeRemoteState(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+	}
+
+	clock := newFakeClock()
+	s1 := New(2, "node01", "address01", runner, WithClock(clock))
+	s1.Start()
+	clock.advance(0)
+
+	s2 := New(2, "node02", "address02", &PartitionRunnerMock{})
+	s2.MergeRemoteState(s1.LocalState())
+
+	assert.Equal(t, partitionState{
+		incarnation: 1,
+		current:     "node01",
+	}, s2.core.partitions[1].state)
+}
+
+func TestService_Shutdown_Before_Join__Not_Join(t *testing.T) {
+	delegate := &NodeDelegateMock{
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "address01", &PartitionRunnerMock{},
+		WithStaticAddresses([]string{"address02"}),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+	)
+	s.Start()
+	shutdownService(t, s)
+	clock.advance(time.Second)
+
+	assert.Equal(t, 0, len(delegate.JoinCalls()))
+	assert.Equal(t, 1, len(delegate.LeaveCalls()))
+}
+
+func TestService_NotifyJoin_With_Node_Meta(t *testing.T) {
+	listener := &nodeListenerMock{
+		onChangeFunc: func(nodes []nodeInfo) {},
+	}
+
+	s := New(4, "node01", "address01", &PartitionRunnerMock{}, WithNodeWeight(2))
+	s.joinMgr.listener = listener
+
+	other := New(4, "node02", "address02", &PartitionRunnerMock{}, WithNodeWeight(5))
+	s.NotifyJoin("node02", "address02", other.NodeMeta())
+	s.NotifyJoin("node03", "address03", nil)
+
+	assert.Equal(t, []nodeInfo{
+		{name: "node01", addr: "address01", meta: nodeMeta{weight: 2}},
+		{name: "node02", addr: "address02", meta: nodeMeta{weight: 5}},
+		{name: "node03", addr: "address03"},
+	}, listener.onChangeCalls()[1].Nodes)
+}
+
+func TestEpoch_Less(t *testing.T) {
+	assert.Equal(t, true, Epoch{Incarnation: 1, Node: "node02"}.Less(Epoch{Incarnation: 2, Node: "node01"}))
+	assert.Equal(t, true, Epoch{Incarnation: 2, Node: "node01"}.Less(Epoch{Incarnation: 2, Node: "node02"}))
+	assert.Equal(t, false, Epoch{Incarnation: 2, Node: "node02"}.Less(Epoch{Incarnation: 2, Node: "node02"}))
+	assert.Equal(t, false, Epoch{Incarnation: 3}.Less(Epoch{Incarnation: 2, Node: "node02"}))
+}
+
+func TestService_CurrentEpoch(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {},
+	}
+	s := New(2, "node01", "address01", runner)
+
+	assert.Equal(t, Epoch{}, s.CurrentEpoch(1))
+
+	s.NotifyMsg(partitionBatch{
+		{id: 1, msg: partitionMsg{incarnation: 5, current: "node02"}},
+	}.Marshal())
+
+	assert.Equal(t, Epoch{Incarnation: 5, Node: "node02"}, s.CurrentEpoch(1))
+	assert.Equal(t, Epoch{}, s.CurrentEpoch(0))
+	assert.Equal(t, Epoch{}, s.CurrentEpoch(2))
+}
+
+func TestService_Shutdown__Context_Done_Before_Drained(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {
+			startCompleted()
+		},
+		StopFunc: func(partition PartitionID, stopCompleted func()) {},
+	}
+	delegate := &NodeDelegateMock{
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "address01", runner, WithNodeDelegate(delegate), WithClock(clock))
+	s.Start()
+	clock.advance(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := s.Shutdown(ctx)
+	assert.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, &ShutdownError{Abandoned: []PartitionID{0, 1}, Err: context.DeadlineExceeded}, err)
+	assert.Equal(t, "shim: left with partitions [0 1] not stopped: context deadline exceeded", err.Error())
+	assert.Equal(t, 2, len(runner.StopCalls()))
+	assert.Equal(t, 1, len(delegate.LeaveCalls()))
+
+	var leftMsg nodeLeftMsg
+	assert.Equal(t, nil, leftMsg.Unmarshal(delegate.BroadcastCalls()[2].Msg))
+	assert.Equal(t, nodeLeftMsg{name: "node01", addr: "address01"}, leftMsg)
+
+	// shutdown again after left
+	assert.Equal(t, nil, s.Shutdown(context.Background()))
+	assert.Equal(t, 1, len(delegate.LeaveCalls()))
+}
+
+func TestService_Shutdown__Join_In_Progress__Not_Blocked(t *testing.T) {
+	joining := make(chan struct{})
+	unblock := make(chan struct{})
+	joined := make(chan struct{})
+	delegate := &NodeDelegateMock{
+		JoinFunc: func(addrs []string) error {
+			close(joining)
+			<-unblock
+			return errors.New("unreachable")
+		},
+		LeaveFunc:     func() {},
+		BroadcastFunc: func(msg []byte) {},
+	}
+
+	s := New(2, "node01", "address01", &PartitionRunnerMock{},
+		WithStaticAddresses([]string{"address02"}),
+		WithNodeDelegate(delegate),
+	)
+	s.joinMgr.listener = &nodeListenerMock{
+		onChangeFunc: func(nodes []nodeInfo) {},
+		onJoinCompletedFunc: func() {
+			close(joined)
+		},
+	}
+	s.Start()
+	<-joining
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_ = s.Shutdown(ctx)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, len(delegate.LeaveCalls()))
+
+	close(unblock)
+	<-joined
+
+	// the join completed after the shutdown does not schedule another one
+	assert.Eventually(t, func() bool {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		return !s.joinRunning
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+}
+
+func TestService_Join_Failed__Retry_With_Backoff(t *testing.T) {
+	runner := &PartitionRunnerMock{
+		StartFunc: func(partition PartitionID, _ Epoch, startCompleted func()) {},
+	}
+
+	clock := newFakeClock()
+
+	var joinTimes []time.Time
+	joinErr := errors.New("join failed")
+	delegate := &NodeDelegateMock{
+		JoinFunc: func(addrs []string) error {
+			joinTimes = append(joinTimes, clock.Now())
+			return joinErr
+		},
+	}
+
+	s := New(2, "node01", "address01", runner,
+		WithStaticAddresses([]string{"address01", "address02"}),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+		WithJoinBackoff(time.Second, 4*time.Second),
+	)
+	s.Start()
+	clock.advance(0)
+
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+	// partitions are allocated even though the join failed
+	assert.Equal(t, 2, len(runner.StartCalls()))
+
+	clock.advance(12 * time.Second)
+	joinErr = nil
+	clock.advance(4 * time.Second)
+
+	// the delays are randomized between half and all of the backoff
+	maxDelays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, maxDelay := range maxDelays {
+		delay := joinTimes[i+1].Sub(joinTimes[i])
+		assert.GreaterOrEqual(t, delay, maxDelay/2)
+		assert.LessOrEqual(t, delay, maxDelay)
+	}
+
+	// joined again after the rejoin interval, address02 is still not a member
+	count := len(joinTimes)
+	last := joinTimes[count-1]
+	clock.advance(last.Add(30 * time.Second).Sub(clock.Now()))
+	assert.Equal(t, count+1, len(joinTimes))
+	assert.Equal(t, last.Add(30*time.Second), joinTimes[count])
+}
+
+func TestService_Rejoin__All_Members__Not_Join(t *testing.T) {
+	delegate := &NodeDelegateMock{
+		JoinFunc: func(addrs []string) error { return nil },
+	}
+
+	clock := newFakeClock()
+	s := New(2, "node01", "address01", &PartitionRunnerMock{},
+		WithStaticAddresses([]string{"address01", "address02"}),
+		WithNodeDelegate(delegate),
+		WithClock(clock),
+		WithRejoinInterval(10*time.Second),
+	)
+	s.joinMgr.listener = &nodeListenerMock{
+		onChangeFunc:        func(nodes []nodeInfo) {},
+		onJoinCompletedFunc: func() {},
+	}
+	s.Start()
+	clock.advance(0)
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+
+	s.NotifyJoin("node02", "address02", nil)
+	clock.advance(time.Hour)
+	assert.Equal(t, 1, len(delegate.JoinCalls()))
+
+	// address02 is split away
+	s.NotifyLeave("node02")
+	clock.advance(10 * time.Second)
+	assert.Equal(t, 2, len(delegate.JoinCalls()))
+	assert.Equal(t, []string{"address02"}, delegate.JoinCalls()[1].Addrs)
+}
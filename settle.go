@@ -0,0 +1,77 @@
+package shim
+
+// reservation keeps the partitions of a node that left the cluster without a graceful leave,
+// until it comes back or its grace period expires
+type reservation struct {
+	timer Timer
+}
+
+// delayNodes postpones the membership change until no other change happens during the settle delay,
+// so a burst of joins and leaves results in a single reallocation
+func (s *coreService) delayNodes(nodes []nodeInfo) {
+	s.pendingNodes = nodes
+	if s.settleTimer == nil {
+		s.settleTimer = s.options.clock.NewTimer(s.options.settleDelay, s.settle)
+		return
+	}
+	s.settleTimer.Reset()
+}
+
+func (s *coreService) settle() {
+	s.lock()
+	defer s.unlock()
+
+	if s.pendingNodes == nil {
+		return
+	}
+	nodes := s.pendingNodes
+	s.pendingNodes = nil
+	s.applyNodes(nodes)
+}
+
+func (s *coreService) reserve(name string) {
+	if _, existed := s.reserved[name]; existed {
+		return
+	}
+
+	r := &reservation{}
+	r.timer = s.options.clock.NewTimer(s.options.reservationPeriod, func() {
+		s.reservationExpired(name, r)
+	})
+	s.reserved[name] = r
+}
+
+func (s *coreService) unreserve(name string) {
+	r, existed := s.reserved[name]
+	if !existed {
+		return
+	}
+	r.timer.Stop()
+	delete(s.reserved, name)
+}
+
+func (s *coreService) reservationExpired(name string, r *reservation) {
+	s.lock()
+	defer s.unlock()
+
+	if s.reserved[name] != r {
+		return
+	}
+	delete(s.reserved, name)
+
+	s.nodeLeave(name)
+	s.reallocate()
+}
+
+// keepReserved leaves the partitions of reserved nodes to them instead of reallocating them
+func (s *coreService) keepReserved(owners []string) {
+	if len(s.reserved) == 0 {
+		return
+	}
+	for i := range s.partitions {
+		holder := s.partitions[i].state.holder()
+		if _, existed := s.reserved[holder]; existed {
+			owners[i] = holder
+		}
+	}
+}
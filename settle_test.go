@@ -0,0 +1,103 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCoreService_Settle_Delay__Coalesce_Membership_Changes(t *testing.T) {
+	clock := newFakeClock()
+	c := newCoreServiceTest(4, WithClock(clock), WithSettleDelay(time.Second))
+
+	c.core.onJoinCompleted()
+	for i := 0; i < 4; i++ {
+		c.startCompleted[PartitionID(i)]()
+	}
+
+	twoNodes := []nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	}
+
+	// node02 flapping
+	c.core.onChange(twoNodes)
+	clock.advance(500 * time.Millisecond)
+	c.core.onChange([]nodeInfo{{name: "node01", addr: "address01"}})
+	clock.advance(500 * time.Millisecond)
+	c.core.onChange(twoNodes)
+
+	clock.advance(999 * time.Millisecond)
+	assert.Equal(t, 0, len(c.runner.StopCalls()))
+	assert.Equal(t, 1, len(c.core.nodes))
+
+	clock.advance(time.Millisecond)
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+	assert.Equal(t, twoNodes, c.core.nodes)
+
+	clock.advance(time.Hour)
+	assert.Equal(t, []PartitionID{2, 3}, c.stoppedPartitions())
+}
+
+func newReservationTest(clock *fakeClock) *coreServiceTest {
+	c := newCoreServiceTest(2, WithClock(clock), WithReservationPeriod(10*time.Second))
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+	c.core.recvPartitionMsgs([]partitionEntry{
+		{id: 1, msg: partitionMsg{incarnation: 1, current: "node02"}},
+	})
+	c.core.onJoinCompleted()
+	c.startCompleted[0]()
+	return c
+}
+
+func TestCoreService_Reservation__Node_Back_Before_Expired__Keep_Partitions(t *testing.T) {
+	clock := newFakeClock()
+	c := newReservationTest(clock)
+
+	c.core.onChange([]nodeInfo{{name: "node01", addr: "address01"}})
+	assert.Equal(t, []PartitionID{0}, c.startedPartitions())
+	assert.Equal(t, "node02", c.core.partitions[1].state.owner)
+
+	clock.advance(9 * time.Second)
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02"},
+	})
+
+	clock.advance(time.Hour)
+	assert.Equal(t, []PartitionID{0}, c.startedPartitions())
+	assert.Equal(t, "node02", c.core.partitions[1].state.holder())
+}
+
+func TestCoreService_Reservation__Expired__Reallocate(t *testing.T) {
+	clock := newFakeClock()
+	c := newReservationTest(clock)
+
+	c.core.onChange([]nodeInfo{{name: "node01", addr: "address01"}})
+
+	clock.advance(9999 * time.Millisecond)
+	assert.Equal(t, []PartitionID{0}, c.startedPartitions())
+
+	clock.advance(time.Millisecond)
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+	assert.Equal(t, true, c.core.partitions[1].state.left)
+	assert.Equal(t, 0, len(c.core.reserved))
+}
+
+func TestCoreService_Reservation__Graceful_Leave__Not_Reserved(t *testing.T) {
+	clock := newFakeClock()
+	c := newReservationTest(clock)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node01", addr: "address01"},
+		{name: "node02", addr: "address02", leaving: true},
+	})
+	c.core.onChange([]nodeInfo{{name: "node01", addr: "address01"}})
+
+	assert.Equal(t, []PartitionID{0, 1}, c.startedPartitions())
+	assert.Equal(t, 0, len(c.core.reserved))
+}
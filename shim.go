@@ -1,25 +1,73 @@
 package shim
 
+import "time"
+
 // PartitionID ...
 type PartitionID uint32
 
-//go:generate moq -out shim_mocks_test.go . PartitionRunner NodeDelegate nodeListener nodeBroadcaster
+//go:generate moq -out shim_mocks_test.go . PartitionRunner ReplicaRunner NodeDelegate nodeListener nodeBroadcaster
+
+// Epoch is the fencing token of a run of a partition, it is ordered by incarnation then by node name.
+// Every run of a partition has a distinct epoch, a newer run always has a greater epoch
+type Epoch struct {
+	Incarnation uint64
+	Node        string
+}
+
+// Less reports whether the epoch e is older than other
+func (e Epoch) Less(other Epoch) bool {
+	if e.Incarnation != other.Incarnation {
+		return e.Incarnation < other.Incarnation
+	}
+	return e.Node < other.Node
+}
 
 // PartitionRunner ...
 type PartitionRunner interface {
-	Start(partition PartitionID, startCompleted func())
+	// Start starts running the partition, writes made by the run should be fenced by epoch
+	Start(partition PartitionID, epoch Epoch, startCompleted func())
 	Stop(partition PartitionID, stopCompleted func())
 }
 
+// ReplicaRunner is a PartitionRunner that also keeps warm standbys of partitions owned by other nodes.
+// When the primary of a partition leaves, the partition is moved to its first standby
+// and started by Promote instead of Start
+type ReplicaRunner interface {
+	PartitionRunner
+
+	StartStandby(partition PartitionID, startCompleted func())
+	StopStandby(partition PartitionID, stopCompleted func())
+	Promote(partition PartitionID, epoch Epoch, promoteCompleted func())
+}
+
 // NodeDelegate ...
 type NodeDelegate interface {
 	Join(addrs []string) error
 	Leave()
+	Broadcast(msg []byte)
 }
 
 type nodeInfo struct {
 	name string
 	addr string
+	meta nodeMeta
+
+	// leaving is set for members draining their partitions before leaving the cluster,
+	// they keep holding their partitions but are not allocated new ones
+	leaving bool
+}
+
+// nodeMeta is advertised by each node through the membership layer
+type nodeMeta struct {
+	weight int
+	labels map[string]string
+}
+
+func (m nodeMeta) getWeight() int {
+	if m.weight <= 0 {
+		return 1
+	}
+	return m.weight
 }
 
 type nodeListener interface {
@@ -36,3 +84,9 @@ type Timer interface {
 	Reset()
 	Stop()
 }
+
+// Clock is the source of time and timers of a Service, it can be replaced by a virtual clock in tests
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration, callback func()) Timer
+}
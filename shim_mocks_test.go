@@ -13,25 +13,25 @@ var _ PartitionRunner = &PartitionRunnerMock{}
 
 // PartitionRunnerMock is a mock implementation of PartitionRunner.
 //
-// 	func TestSomethingThatUsesPartitionRunner(t *testing.T) {
-//
-// 		// make and configure a mocked PartitionRunner
-// 		mockedPartitionRunner := &PartitionRunnerMock{
-// 			StartFunc: func(partition PartitionID, startCompleted func())  {
-// 				panic("mock out the Start method")
-// 			},
-// 			StopFunc: func(partition PartitionID, stopCompleted func())  {
-// 				panic("mock out the Stop method")
-// 			},
-// 		}
-//
-// 		// use mockedPartitionRunner in code that requires PartitionRunner
-// 		// and then make assertions.
-//
-// 	}
+//	func TestSomethingThatUsesPartitionRunner(t *testing.T) {
+//
+//		// make and configure a mocked PartitionRunner
+//		mockedPartitionRunner := &PartitionRunnerMock{
+//			StartFunc: func(partition PartitionID, epoch Epoch, startCompleted func())  {
+//				panic("mock out the Start method")
+//			},
+//			StopFunc: func(partition PartitionID, stopCompleted func())  {
+//				panic("mock out the Stop method")
+//			},
+//		}
+//
+//		// use mockedPartitionRunner in code that requires PartitionRunner
+//		// and then make assertions.
+//
+//	}
 type PartitionRunnerMock struct {
 	// StartFunc mocks the Start method.
-	StartFunc func(partition PartitionID, startCompleted func())
+	StartFunc func(partition PartitionID, epoch Epoch, startCompleted func())
 
 	// StopFunc mocks the Stop method.
 	StopFunc func(partition PartitionID, stopCompleted func())
@@ -42,6 +42,8 @@ type PartitionRunnerMock struct {
 		Start []struct {
 			// Partition is the partition argument value.
 			Partition PartitionID
+			// Epoch is the epoch argument value.
+			Epoch Epoch
 			// StartCompleted is the startCompleted argument value.
 			StartCompleted func()
 		}
@@ -58,32 +60,37 @@ type PartitionRunnerMock struct {
 }
 
 // Start calls StartFunc.
-func (mock *PartitionRunnerMock) Start(partition PartitionID, startCompleted func()) {
+func (mock *PartitionRunnerMock) Start(partition PartitionID, epoch Epoch, startCompleted func()) {
 	if mock.StartFunc == nil {
 		panic("PartitionRunnerMock.StartFunc: method is nil but PartitionRunner.Start was just called")
 	}
 	callInfo := struct {
 		Partition      PartitionID
+		Epoch          Epoch
 		StartCompleted func()
 	}{
 		Partition:      partition,
+		Epoch:          epoch,
 		StartCompleted: startCompleted,
 	}
 	mock.lockStart.Lock()
 	mock.calls.Start = append(mock.calls.Start, callInfo)
 	mock.lockStart.Unlock()
-	mock.StartFunc(partition, startCompleted)
+	mock.StartFunc(partition, epoch, startCompleted)
 }
 
 // StartCalls gets all the calls that were made to Start.
 // Check the length with:
-//     len(mockedPartitionRunner.StartCalls())
+//
+//	len(mockedPartitionRunner.StartCalls())
 func (mock *PartitionRunnerMock) StartCalls() []struct {
 	Partition      PartitionID
+	Epoch          Epoch
 	StartCompleted func()
 } {
 	var calls []struct {
 		Partition      PartitionID
+		Epoch          Epoch
 		StartCompleted func()
 	}
 	mock.lockStart.RLock()
@@ -112,7 +119,8 @@ func (mock *PartitionRunnerMock) Stop(partition PartitionID, stopCompleted func(
 
 // StopCalls gets all the calls that were made to Stop.
 // Check the length with:
-//     len(mockedPartitionRunner.StopCalls())
+//
+//	len(mockedPartitionRunner.StopCalls())
 func (mock *PartitionRunnerMock) StopCalls() []struct {
 	Partition     PartitionID
 	StopCompleted func()
@@ -127,29 +135,319 @@ func (mock *PartitionRunnerMock) StopCalls() []struct {
 	return calls
 }
 
+// Ensure, that ReplicaRunnerMock does implement ReplicaRunner.
+// If this is not the case, regenerate this file with moq.
+var _ ReplicaRunner = &ReplicaRunnerMock{}
+
+// ReplicaRunnerMock is a mock implementation of ReplicaRunner.
+//
+//	func TestSomethingThatUsesReplicaRunner(t *testing.T) {
+//
+//		// make and configure a mocked ReplicaRunner
+//		mockedReplicaRunner := &ReplicaRunnerMock{
+//			PromoteFunc: func(partition PartitionID, epoch Epoch, promoteCompleted func())  {
+//				panic("mock out the Promote method")
+//			},
+//			StartFunc: func(partition PartitionID, epoch Epoch, startCompleted func())  {
+//				panic("mock out the Start method")
+//			},
+//			StartStandbyFunc: func(partition PartitionID, startCompleted func())  {
+//				panic("mock out the StartStandby method")
+//			},
+//			StopFunc: func(partition PartitionID, stopCompleted func())  {
+//				panic("mock out the Stop method")
+//			},
+//			StopStandbyFunc: func(partition PartitionID, stopCompleted func())  {
+//				panic("mock out the StopStandby method")
+//			},
+//		}
+//
+//		// use mockedReplicaRunner in code that requires ReplicaRunner
+//		// and then make assertions.
+//
+//	}
+type ReplicaRunnerMock struct {
+	// PromoteFunc mocks the Promote method.
+	PromoteFunc func(partition PartitionID, epoch Epoch, promoteCompleted func())
+
+	// StartFunc mocks the Start method.
+	StartFunc func(partition PartitionID, epoch Epoch, startCompleted func())
+
+	// StartStandbyFunc mocks the StartStandby method.
+	StartStandbyFunc func(partition PartitionID, startCompleted func())
+
+	// StopFunc mocks the Stop method.
+	StopFunc func(partition PartitionID, stopCompleted func())
+
+	// StopStandbyFunc mocks the StopStandby method.
+	StopStandbyFunc func(partition PartitionID, stopCompleted func())
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Promote holds details about calls to the Promote method.
+		Promote []struct {
+			// Partition is the partition argument value.
+			Partition PartitionID
+			// Epoch is the epoch argument value.
+			Epoch Epoch
+			// PromoteCompleted is the promoteCompleted argument value.
+			PromoteCompleted func()
+		}
+		// Start holds details about calls to the Start method.
+		Start []struct {
+			// Partition is the partition argument value.
+			Partition PartitionID
+			// Epoch is the epoch argument value.
+			Epoch Epoch
+			// StartCompleted is the startCompleted argument value.
+			StartCompleted func()
+		}
+		// StartStandby holds details about calls to the StartStandby method.
+		StartStandby []struct {
+			// Partition is the partition argument value.
+			Partition PartitionID
+			// StartCompleted is the startCompleted argument value.
+			StartCompleted func()
+		}
+		// Stop holds details about calls to the Stop method.
+		Stop []struct {
+			// Partition is the partition argument value.
+			Partition PartitionID
+			// StopCompleted is the stopCompleted argument value.
+			StopCompleted func()
+		}
+		// StopStandby holds details about calls to the StopStandby method.
+		StopStandby []struct {
+			// Partition is the partition argument value.
+			Partition PartitionID
+			// StopCompleted is the stopCompleted argument value.
+			StopCompleted func()
+		}
+	}
+	lockPromote      sync.RWMutex
+	lockStart        sync.RWMutex
+	lockStartStandby sync.RWMutex
+	lockStop         sync.RWMutex
+	lockStopStandby  sync.RWMutex
+}
+
+// Promote calls PromoteFunc.
+func (mock *ReplicaRunnerMock) Promote(partition PartitionID, epoch Epoch, promoteCompleted func()) {
+	if mock.PromoteFunc == nil {
+		panic("ReplicaRunnerMock.PromoteFunc: method is nil but ReplicaRunner.Promote was just called")
+	}
+	callInfo := struct {
+		Partition        PartitionID
+		Epoch            Epoch
+		PromoteCompleted func()
+	}{
+		Partition:        partition,
+		Epoch:            epoch,
+		PromoteCompleted: promoteCompleted,
+	}
+	mock.lockPromote.Lock()
+	mock.calls.Promote = append(mock.calls.Promote, callInfo)
+	mock.lockPromote.Unlock()
+	mock.PromoteFunc(partition, epoch, promoteCompleted)
+}
+
+// PromoteCalls gets all the calls that were made to Promote.
+// Check the length with:
+//
+//	len(mockedReplicaRunner.PromoteCalls())
+func (mock *ReplicaRunnerMock) PromoteCalls() []struct {
+	Partition        PartitionID
+	Epoch            Epoch
+	PromoteCompleted func()
+} {
+	var calls []struct {
+		Partition        PartitionID
+		Epoch            Epoch
+		PromoteCompleted func()
+	}
+	mock.lockPromote.RLock()
+	calls = mock.calls.Promote
+	mock.lockPromote.RUnlock()
+	return calls
+}
+
+// Start calls StartFunc.
+func (mock *ReplicaRunnerMock) Start(partition PartitionID, epoch Epoch, startCompleted func()) {
+	if mock.StartFunc == nil {
+		panic("ReplicaRunnerMock.StartFunc: method is nil but ReplicaRunner.Start was just called")
+	}
+	callInfo := struct {
+		Partition      PartitionID
+		Epoch          Epoch
+		StartCompleted func()
+	}{
+		Partition:      partition,
+		Epoch:          epoch,
+		StartCompleted: startCompleted,
+	}
+	mock.lockStart.Lock()
+	mock.calls.Start = append(mock.calls.Start, callInfo)
+	mock.lockStart.Unlock()
+	mock.StartFunc(partition, epoch, startCompleted)
+}
+
+// StartCalls gets all the calls that were made to Start.
+// Check the length with:
+//
+//	len(mockedReplicaRunner.StartCalls())
+func (mock *ReplicaRunnerMock) StartCalls() []struct {
+	Partition      PartitionID
+	Epoch          Epoch
+	StartCompleted func()
+} {
+	var calls []struct {
+		Partition      PartitionID
+		Epoch          Epoch
+		StartCompleted func()
+	}
+	mock.lockStart.RLock()
+	calls = mock.calls.Start
+	mock.lockStart.RUnlock()
+	return calls
+}
+
+// StartStandby calls StartStandbyFunc.
+func (mock *ReplicaRunnerMock) StartStandby(partition PartitionID, startCompleted func()) {
+	if mock.StartStandbyFunc == nil {
+		panic("ReplicaRunnerMock.StartStandbyFunc: method is nil but ReplicaRunner.StartStandby was just called")
+	}
+	callInfo := struct {
+		Partition      PartitionID
+		StartCompleted func()
+	}{
+		Partition:      partition,
+		StartCompleted: startCompleted,
+	}
+	mock.lockStartStandby.Lock()
+	mock.calls.StartStandby = append(mock.calls.StartStandby, callInfo)
+	mock.lockStartStandby.Unlock()
+	mock.StartStandbyFunc(partition, startCompleted)
+}
+
+// StartStandbyCalls gets all the calls that were made to StartStandby.
+// Check the length with:
+//
+//	len(mockedReplicaRunner.StartStandbyCalls())
+func (mock *ReplicaRunnerMock) StartStandbyCalls() []struct {
+	Partition      PartitionID
+	StartCompleted func()
+} {
+	var calls []struct {
+		Partition      PartitionID
+		StartCompleted func()
+	}
+	mock.lockStartStandby.RLock()
+	calls = mock.calls.StartStandby
+	mock.lockStartStandby.RUnlock()
+	return calls
+}
+
+// Stop calls StopFunc.
+func (mock *ReplicaRunnerMock) Stop(partition PartitionID, stopCompleted func()) {
+	if mock.StopFunc == nil {
+		panic("ReplicaRunnerMock.StopFunc: method is nil but ReplicaRunner.Stop was just called")
+	}
+	callInfo := struct {
+		Partition     PartitionID
+		StopCompleted func()
+	}{
+		Partition:     partition,
+		StopCompleted: stopCompleted,
+	}
+	mock.lockStop.Lock()
+	mock.calls.Stop = append(mock.calls.Stop, callInfo)
+	mock.lockStop.Unlock()
+	mock.StopFunc(partition, stopCompleted)
+}
+
+// StopCalls gets all the calls that were made to Stop.
+// Check the length with:
+//
+//	len(mockedReplicaRunner.StopCalls())
+func (mock *ReplicaRunnerMock) StopCalls() []struct {
+	Partition     PartitionID
+	StopCompleted func()
+} {
+	var calls []struct {
+		Partition     PartitionID
+		StopCompleted func()
+	}
+	mock.lockStop.RLock()
+	calls = mock.calls.Stop
+	mock.lockStop.RUnlock()
+	return calls
+}
+
+// StopStandby calls StopStandbyFunc.
+func (mock *ReplicaRunnerMock) StopStandby(partition PartitionID, stopCompleted func()) {
+	if mock.StopStandbyFunc == nil {
+		panic("ReplicaRunnerMock.StopStandbyFunc: method is nil but ReplicaRunner.StopStandby was just called")
+	}
+	callInfo := struct {
+		Partition     PartitionID
+		StopCompleted func()
+	}{
+		Partition:     partition,
+		StopCompleted: stopCompleted,
+	}
+	mock.lockStopStandby.Lock()
+	mock.calls.StopStandby = append(mock.calls.StopStandby, callInfo)
+	mock.lockStopStandby.Unlock()
+	mock.StopStandbyFunc(partition, stopCompleted)
+}
+
+// StopStandbyCalls gets all the calls that were made to StopStandby.
+// Check the length with:
+//
+//	len(mockedReplicaRunner.StopStandbyCalls())
+func (mock *ReplicaRunnerMock) StopStandbyCalls() []struct {
+	Partition     PartitionID
+	StopCompleted func()
+} {
+	var calls []struct {
+		Partition     PartitionID
+		StopCompleted func()
+	}
+	mock.lockStopStandby.RLock()
+	calls = mock.calls.StopStandby
+	mock.lockStopStandby.RUnlock()
+	return calls
+}
+
 // Ensure, that NodeDelegateMock does implement NodeDelegate.
 // If this is not the case, regenerate this file with moq.
 var _ NodeDelegate = &NodeDelegateMock{}
 
 // NodeDelegateMock is a mock implementation of NodeDelegate.
 //
-// 	func TestSomethingThatUsesNodeDelegate(t *testing.T) {
+//	func TestSomethingThatUsesNodeDelegate(t *testing.T) {
 //
-// 		// make and configure a mocked NodeDelegate
-// 		mockedNodeDelegate := &NodeDelegateMock{
-// 			JoinFunc: func(addrs []string) error {
-// 				panic("mock out the Join method")
-// 			},
-// 			LeaveFunc: func()  {
-// 				panic("mock out the Leave method")
-// 			},
-// 		}
+//		// make and configure a mocked NodeDelegate
+//		mockedNodeDelegate := &NodeDelegateMock{
+//			BroadcastFunc: func(msg []byte)  {
+//				panic("mock out the Broadcast method")
+//			},
+//			JoinFunc: func(addrs []string) error {
+//				panic("mock out the Join method")
+//			},
+//			LeaveFunc: func()  {
+//				panic("mock out the Leave method")
+//			},
+//		}
 //
-// 		// use mockedNodeDelegate in code that requires NodeDelegate
-// 		// and then make assertions.
+//		// use mockedNodeDelegate in code that requires NodeDelegate
+//		// and then make assertions.
 //
-// 	}
+//	}
 type NodeDelegateMock struct {
+	// BroadcastFunc mocks the Broadcast method.
+	BroadcastFunc func(msg []byte)
+
 	// JoinFunc mocks the Join method.
 	JoinFunc func(addrs []string) error
 
@@ -158,6 +456,11 @@ type NodeDelegateMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// Broadcast holds details about calls to the Broadcast method.
+		Broadcast []struct {
+			// Msg is the msg argument value.
+			Msg []byte
+		}
 		// Join holds details about calls to the Join method.
 		Join []struct {
 			// Addrs is the addrs argument value.
@@ -167,8 +470,41 @@ type NodeDelegateMock struct {
 		Leave []struct {
 		}
 	}
-	lockJoin  sync.RWMutex
-	lockLeave sync.RWMutex
+	lockBroadcast sync.RWMutex
+	lockJoin      sync.RWMutex
+	lockLeave     sync.RWMutex
+}
+
+// Broadcast calls BroadcastFunc.
+func (mock *NodeDelegateMock) Broadcast(msg []byte) {
+	if mock.BroadcastFunc == nil {
+		panic("NodeDelegateMock.BroadcastFunc: method is nil but NodeDelegate.Broadcast was just called")
+	}
+	callInfo := struct {
+		Msg []byte
+	}{
+		Msg: msg,
+	}
+	mock.lockBroadcast.Lock()
+	mock.calls.Broadcast = append(mock.calls.Broadcast, callInfo)
+	mock.lockBroadcast.Unlock()
+	mock.BroadcastFunc(msg)
+}
+
+// BroadcastCalls gets all the calls that were made to Broadcast.
+// Check the length with:
+//
+//	len(mockedNodeDelegate.BroadcastCalls())
+func (mock *NodeDelegateMock) BroadcastCalls() []struct {
+	Msg []byte
+} {
+	var calls []struct {
+		Msg []byte
+	}
+	mock.lockBroadcast.RLock()
+	calls = mock.calls.Broadcast
+	mock.lockBroadcast.RUnlock()
+	return calls
 }
 
 // Join calls JoinFunc.
@@ -189,7 +525,8 @@ func (mock *NodeDelegateMock) Join(addrs []string) error {
 
 // JoinCalls gets all the calls that were made to Join.
 // Check the length with:
-//     len(mockedNodeDelegate.JoinCalls())
+//
+//	len(mockedNodeDelegate.JoinCalls())
 func (mock *NodeDelegateMock) JoinCalls() []struct {
 	Addrs []string
 } {
@@ -217,7 +554,8 @@ func (mock *NodeDelegateMock) Leave() {
 
 // LeaveCalls gets all the calls that were made to Leave.
 // Check the length with:
-//     len(mockedNodeDelegate.LeaveCalls())
+//
+//	len(mockedNodeDelegate.LeaveCalls())
 func (mock *NodeDelegateMock) LeaveCalls() []struct {
 } {
 	var calls []struct {
@@ -234,22 +572,22 @@ var _ nodeListener = &nodeListenerMock{}
 
 // nodeListenerMock is a mock implementation of nodeListener.
 //
-// 	func TestSomethingThatUsesnodeListener(t *testing.T) {
+//	func TestSomethingThatUsesnodeListener(t *testing.T) {
 //
-// 		// make and configure a mocked nodeListener
-// 		mockednodeListener := &nodeListenerMock{
-// 			onChangeFunc: func(nodes []nodeInfo)  {
-// 				panic("mock out the onChange method")
-// 			},
-// 			onJoinCompletedFunc: func()  {
-// 				panic("mock out the onJoinCompleted method")
-// 			},
-// 		}
+//		// make and configure a mocked nodeListener
+//		mockednodeListener := &nodeListenerMock{
+//			onChangeFunc: func(nodes []nodeInfo)  {
+//				panic("mock out the onChange method")
+//			},
+//			onJoinCompletedFunc: func()  {
+//				panic("mock out the onJoinCompleted method")
+//			},
+//		}
 //
-// 		// use mockednodeListener in code that requires nodeListener
-// 		// and then make assertions.
+//		// use mockednodeListener in code that requires nodeListener
+//		// and then make assertions.
 //
-// 	}
+//	}
 type nodeListenerMock struct {
 	// onChangeFunc mocks the onChange method.
 	onChangeFunc func(nodes []nodeInfo)
@@ -290,7 +628,8 @@ func (mock *nodeListenerMock) onChange(nodes []nodeInfo) {
 
 // onChangeCalls gets all the calls that were made to onChange.
 // Check the length with:
-//     len(mockednodeListener.onChangeCalls())
+//
+//	len(mockednodeListener.onChangeCalls())
 func (mock *nodeListenerMock) onChangeCalls() []struct {
 	Nodes []nodeInfo
 } {
@@ -318,7 +657,8 @@ func (mock *nodeListenerMock) onJoinCompleted() {
 
 // onJoinCompletedCalls gets all the calls that were made to onJoinCompleted.
 // Check the length with:
-//     len(mockednodeListener.onJoinCompletedCalls())
+//
+//	len(mockednodeListener.onJoinCompletedCalls())
 func (mock *nodeListenerMock) onJoinCompletedCalls() []struct {
 } {
 	var calls []struct {
@@ -335,19 +675,19 @@ var _ nodeBroadcaster = &nodeBroadcasterMock{}
 
 // nodeBroadcasterMock is a mock implementation of nodeBroadcaster.
 //
-// 	func TestSomethingThatUsesnodeBroadcaster(t *testing.T) {
+//	func TestSomethingThatUsesnodeBroadcaster(t *testing.T) {
 //
-// 		// make and configure a mocked nodeBroadcaster
-// 		mockednodeBroadcaster := &nodeBroadcasterMock{
-// 			broadcastFunc: func(msg nodeLeftMsg)  {
-// 				panic("mock out the broadcast method")
-// 			},
-// 		}
+//		// make and configure a mocked nodeBroadcaster
+//		mockednodeBroadcaster := &nodeBroadcasterMock{
+//			broadcastFunc: func(msg nodeLeftMsg)  {
+//				panic("mock out the broadcast method")
+//			},
+//		}
 //
-// 		// use mockednodeBroadcaster in code that requires nodeBroadcaster
-// 		// and then make assertions.
+//		// use mockednodeBroadcaster in code that requires nodeBroadcaster
+//		// and then make assertions.
 //
-// 	}
+//	}
 type nodeBroadcasterMock struct {
 	// broadcastFunc mocks the broadcast method.
 	broadcastFunc func(msg nodeLeftMsg)
@@ -381,7 +721,8 @@ func (mock *nodeBroadcasterMock) broadcast(msg nodeLeftMsg) {
 
 // broadcastCalls gets all the calls that were made to broadcast.
 // Check the length with:
-//     len(mockednodeBroadcaster.broadcastCalls())
+//
+//	len(mockednodeBroadcaster.broadcastCalls())
 func (mock *nodeBroadcasterMock) broadcastCalls() []struct {
 	Msg nodeLeftMsg
 } {
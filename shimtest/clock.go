@@ -0,0 +1,140 @@
+package shimtest
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/QuangTung97/shim"
+)
+
+// Clock is a virtual clock, timers and scheduled events only run when the clock is advanced.
+// It is not thread safe, everything in a simulation runs on the goroutine that advances the clock
+type Clock struct {
+	now    time.Time
+	seq    uint64
+	events eventHeap
+}
+
+type event struct {
+	at    time.Time
+	seq   uint64
+	timer *timer
+	gen   uint64
+	fn    func()
+}
+
+type eventHeap []*event
+
+type timer struct {
+	clock    *Clock
+	d        time.Duration
+	callback func()
+	gen      uint64
+}
+
+var _ shim.Clock = &Clock{}
+
+// NewClock creates a virtual clock starting at the given time
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now implements shim.Clock
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// NewTimer implements shim.Clock
+func (c *Clock) NewTimer(d time.Duration, callback func()) shim.Timer {
+	t := &timer{
+		clock:    c,
+		d:        d,
+		callback: callback,
+	}
+	t.Reset()
+	return t
+}
+
+// AfterFunc runs fn after the duration d of virtual time
+func (c *Clock) AfterFunc(d time.Duration, fn func()) {
+	c.push(&event{at: c.now.Add(d), fn: fn})
+}
+
+// Advance runs all the events that are due in the next duration d, in order of time
+func (c *Clock) Advance(d time.Duration) {
+	end := c.now.Add(d)
+	for len(c.events) > 0 && !c.events[0].at.After(end) {
+		c.runNext()
+	}
+	c.now = end
+}
+
+// Step runs the next event and moves the clock to its time, returns false when there is no event
+func (c *Clock) Step() bool {
+	if len(c.events) == 0 {
+		return false
+	}
+	c.runNext()
+	return true
+}
+
+func (c *Clock) runNext() {
+	e := heap.Pop(&c.events).(*event)
+	c.now = e.at
+
+	if e.timer != nil {
+		if e.timer.gen != e.gen {
+			return
+		}
+		e.timer.callback()
+		return
+	}
+	e.fn()
+}
+
+func (c *Clock) push(e *event) {
+	c.seq++
+	e.seq = c.seq
+	heap.Push(&c.events, e)
+}
+
+func (t *timer) Reset() {
+	t.gen++
+	t.clock.push(&event{
+		at:    t.clock.now.Add(t.d),
+		timer: t,
+		gen:   t.gen,
+	})
+}
+
+func (t *timer) Stop() {
+	t.gen++
+}
+
+func (h eventHeap) Len() int {
+	return len(h)
+}
+
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h eventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *eventHeap) Push(x interface{}) {
+	*h = append(*h, x.(*event))
+}
+
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
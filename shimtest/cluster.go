@@ -0,0 +1,295 @@
+package shimtest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/QuangTung97/shim"
+)
+
+// Config ...
+type Config struct {
+	NodeCount      int
+	PartitionCount int
+	Seed           int64
+
+	// MinDelay and MaxDelay are the range of random delays of messages
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// DropRate is the probability of a broadcast message being lost
+	DropRate float64
+
+	// RunnerDelay is the maximum time a runner takes to start or stop a partition
+	RunnerDelay time.Duration
+
+	// ProbeInterval is the interval for detecting unreachable members
+	ProbeInterval time.Duration
+	// PushPullInterval is the interval for exchanging the full state with a random member
+	PushPullInterval time.Duration
+
+	// NodeOptions returns additional options for the Service of a node
+	NodeOptions func(name string) []shim.Option
+}
+
+// Cluster runs N Service instances in a single goroutine over a fake network and a virtual clock
+type Cluster struct {
+	conf    Config
+	rand    *rand.Rand
+	clock   *Clock
+	network *Network
+
+	staticAddrs []string
+
+	nodeList []*Node
+	nodes    map[string]*Node
+	addrs    map[string]*Node
+}
+
+// DefaultConfig ...
+func DefaultConfig(seed int64) Config {
+	return Config{
+		NodeCount:      3,
+		PartitionCount: 16,
+		Seed:           seed,
+
+		MinDelay: time.Millisecond,
+		MaxDelay: 20 * time.Millisecond,
+		DropRate: 0,
+
+		RunnerDelay: 50 * time.Millisecond,
+
+		ProbeInterval:    time.Second,
+		PushPullInterval: 5 * time.Second,
+	}
+}
+
+// NodeName returns the name of the i-th node, starting from 0
+func NodeName(i int) string {
+	return fmt.Sprintf("node%02d", i+1)
+}
+
+// NodeAddr returns the address of the i-th node, starting from 0
+func NodeAddr(i int) string {
+	return fmt.Sprintf("address%02d", i+1)
+}
+
+// NewCluster creates the nodes of a cluster, each node uses all node addresses as static addresses
+func NewCluster(conf Config) *Cluster {
+	r := rand.New(rand.NewSource(conf.Seed))
+	clock := NewClock(time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC))
+
+	c := &Cluster{
+		conf:    conf,
+		rand:    r,
+		clock:   clock,
+		network: newNetwork(clock, r, conf),
+
+		nodes: map[string]*Node{},
+		addrs: map[string]*Node{},
+	}
+
+	for i := 0; i < conf.NodeCount; i++ {
+		c.staticAddrs = append(c.staticAddrs, NodeAddr(i))
+	}
+
+	for i := 0; i < conf.NodeCount; i++ {
+		n := &Node{
+			cluster: c,
+			name:    NodeName(i),
+			addr:    NodeAddr(i),
+			members: map[string]struct{}{},
+		}
+		n.runner = newRunner(n)
+		n.service = c.newService(n)
+
+		c.nodeList = append(c.nodeList, n)
+		c.nodes[n.name] = n
+		c.addrs[n.addr] = n
+	}
+	return c
+}
+
+func (c *Cluster) newService(n *Node) *shim.Service {
+	opts := []shim.Option{
+		shim.WithStaticAddresses(c.staticAddrs),
+		shim.WithNodeDelegate(process{node: n, incarnation: n.incarnation}),
+		shim.WithClock(c.clock),
+	}
+	if c.conf.NodeOptions != nil {
+		opts = append(opts, c.conf.NodeOptions(n.name)...)
+	}
+	return shim.New(c.conf.PartitionCount, n.name, n.addr, n.runner, opts...)
+}
+
+// Clock ...
+func (c *Cluster) Clock() *Clock {
+	return c.clock
+}
+
+// Network ...
+func (c *Cluster) Network() *Network {
+	return c.network
+}
+
+// Rand returns the random source of the simulation, using it keeps a run reproducible by its seed
+func (c *Cluster) Rand() *rand.Rand {
+	return c.rand
+}
+
+// Nodes ...
+func (c *Cluster) Nodes() []*Node {
+	return c.nodeList
+}
+
+// Node returns the node with the given name
+func (c *Cluster) Node(name string) *Node {
+	return c.nodes[name]
+}
+
+// Start starts the services of all nodes and the background failure detection and push/pull
+func (c *Cluster) Start() {
+	for _, n := range c.nodeList {
+		c.StartNode(n.name)
+	}
+}
+
+// StartNode starts a single node, nodes that are not started yet can be started later to join the cluster.
+// A node crashed or shut down before is restarted as a new process, with a new Service under the same name
+func (c *Cluster) StartNode(name string) {
+	n := c.nodes[name]
+	if n.incarnation > 0 {
+		n.runner = newRunner(n)
+		n.service = c.newService(n)
+	}
+	n.alive = true
+	n.service.Start()
+
+	incarnation := n.incarnation
+	c.schedulePeriodic(n, incarnation, c.conf.ProbeInterval, n.probe)
+	c.schedulePeriodic(n, incarnation, c.conf.PushPullInterval, n.periodicPushPull)
+}
+
+func (c *Cluster) schedulePeriodic(n *Node, incarnation int, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+
+	var run func()
+	run = func() {
+		if n.incarnation != incarnation {
+			return
+		}
+		fn()
+		c.clock.AfterFunc(interval, run)
+	}
+	c.clock.AfterFunc(interval, run)
+}
+
+// Run advances the virtual clock, processing all events in the duration d
+func (c *Cluster) Run(d time.Duration) {
+	c.clock.Advance(d)
+}
+
+// RunChecking advances the virtual clock by steps, calling check after each step,
+// it stops and returns the first error
+func (c *Cluster) RunChecking(d time.Duration, step time.Duration, check func() error) error {
+	end := c.clock.Now().Add(d)
+	for c.clock.Now().Before(end) {
+		c.clock.Advance(step)
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Crash stops a node without leaving the cluster, its running partitions are lost
+func (c *Cluster) Crash(name string) {
+	c.nodes[name].stop()
+}
+
+// Shutdown starts the graceful shutdown of a node, the node drains its partitions then leaves the cluster
+func (c *Cluster) Shutdown(name string) {
+	c.nodes[name].service.StartShutdown(func() {})
+}
+
+// Running returns, for each partition, the sorted names of alive nodes running it
+func (c *Cluster) Running() map[shim.PartitionID][]string {
+	result := map[shim.PartitionID][]string{}
+	for _, n := range c.nodeList {
+		if !n.alive {
+			continue
+		}
+		for _, p := range n.runner.Running() {
+			result[p] = append(result[p], n.name)
+		}
+	}
+	for _, names := range result {
+		sort.Strings(names)
+	}
+	return result
+}
+
+// CheckNoDuplicate returns an error if any partition is running on more than one alive node
+func (c *Cluster) CheckNoDuplicate() error {
+	running := c.Running()
+	for p := 0; p < c.conf.PartitionCount; p++ {
+		names := running[shim.PartitionID(p)]
+		if len(names) > 1 {
+			return fmt.Errorf("partition %d is running on multiple nodes %v", p, names)
+		}
+	}
+	return nil
+}
+
+// CheckConverged returns an error unless every partition is running on exactly one node of the group,
+// the group is all alive nodes when names is empty
+func (c *Cluster) CheckConverged(names ...string) error {
+	group := map[string]struct{}{}
+	for _, n := range c.nodeList {
+		if !n.alive {
+			continue
+		}
+		if len(names) == 0 {
+			group[n.name] = struct{}{}
+		}
+	}
+	for _, name := range names {
+		group[name] = struct{}{}
+	}
+
+	running := c.Running()
+	for p := 0; p < c.conf.PartitionCount; p++ {
+		var holders []string
+		for _, name := range running[shim.PartitionID(p)] {
+			if _, ok := group[name]; ok {
+				holders = append(holders, name)
+			}
+		}
+		if len(holders) != 1 {
+			return fmt.Errorf("partition %d is running on %v", p, holders)
+		}
+	}
+	return nil
+}
+
+// CheckLookup returns an error unless every alive node finds, with Service.Lookup,
+// the node actually running each partition
+func (c *Cluster) CheckLookup() error {
+	running := c.Running()
+	for _, n := range c.nodeList {
+		if !n.alive {
+			continue
+		}
+		for p := 0; p < c.conf.PartitionCount; p++ {
+			names := running[shim.PartitionID(p)]
+			node, ok := n.service.Lookup(shim.PartitionID(p))
+			if len(names) != 1 || !ok || node.Name != names[0] || node.Addr != c.nodes[names[0]].addr {
+				return fmt.Errorf("node %s finds partition %d on %q, but it is running on %v", n.name, p, node.Name, names)
+			}
+		}
+	}
+	return nil
+}
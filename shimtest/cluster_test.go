@@ -0,0 +1,370 @@
+package shimtest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/QuangTung97/shim"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock_Timers_In_Order(t *testing.T) {
+	c := NewClock(time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC))
+	start := c.Now()
+
+	var calls []string
+	timer := c.NewTimer(2*time.Second, func() { calls = append(calls, "timer") })
+	c.AfterFunc(time.Second, func() { calls = append(calls, "after") })
+	stopped := c.NewTimer(time.Second, func() { calls = append(calls, "stopped") })
+	stopped.Stop()
+
+	c.Advance(3 * time.Second)
+	assert.Equal(t, []string{"after", "timer"}, calls)
+	assert.Equal(t, start.Add(3*time.Second), c.Now())
+
+	timer.Reset()
+	timer.Reset()
+	c.Advance(3 * time.Second)
+	assert.Equal(t, []string{"after", "timer", "timer"}, calls)
+	assert.Equal(t, false, c.Step())
+}
+
+func TestNetwork_Split(t *testing.T) {
+	n := newNetwork(nil, nil, Config{})
+	assert.Equal(t, true, n.Reachable("node01", "node02"))
+
+	n.Split([]string{"node01"}, []string{"node02", "node03"})
+	assert.Equal(t, false, n.Reachable("node01", "node02"))
+	assert.Equal(t, true, n.Reachable("node02", "node03"))
+	assert.Equal(t, false, n.Reachable("node03", "node04"))
+
+	n.Heal()
+	assert.Equal(t, true, n.Reachable("node01", "node02"))
+}
+
+func TestCluster_Converge_Randomized(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.NodeCount = 5
+			conf.PartitionCount = 32
+			conf.DropRate = 0.2
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+
+			assert.Equal(t, nil, c.CheckConverged())
+			for _, n := range c.Nodes() {
+				assert.Equal(t, 4, len(n.Members()))
+			}
+
+			err := c.RunChecking(time.Minute, 10*time.Millisecond, c.CheckNoDuplicate)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, nil, c.CheckConverged())
+			assert.Equal(t, nil, c.CheckLookup())
+		})
+	}
+}
+
+func TestCluster_Same_Seed__Same_Result(t *testing.T) {
+	run := func() map[shim.PartitionID][]string {
+		conf := DefaultConfig(7)
+		conf.NodeCount = 4
+		conf.DropRate = 0.3
+		c := NewCluster(conf)
+		c.Start()
+		c.Run(10 * time.Second)
+		return c.Running()
+	}
+	assert.Equal(t, run(), run())
+}
+
+func TestCluster_Node_Crash__Partitions_Taken_Over(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.DropRate = 0.1
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+
+			c.Crash(NodeName(1))
+			c.Run(time.Minute)
+
+			assert.Equal(t, nil, c.CheckConverged())
+			assert.Equal(t, []string{NodeName(2)}, c.Node(NodeName(0)).Members())
+		})
+	}
+}
+
+func TestCluster_Node_Restarted_Within_Reservation__Partitions_Running_Again(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.NodeCount = 2
+			conf.PartitionCount = 4
+			conf.NodeOptions = func(name string) []shim.Option {
+				return []shim.Option{shim.WithReservationPeriod(time.Hour)}
+			}
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+			before := c.Running()
+
+			c.Crash(NodeName(1))
+			c.Run(10 * time.Second)
+			c.StartNode(NodeName(1))
+			c.Run(time.Minute)
+
+			assert.Equal(t, nil, c.CheckConverged())
+			assert.Equal(t, nil, c.CheckLookup())
+			assert.Equal(t, before, c.Running())
+		})
+	}
+}
+
+func TestCluster_Node_Shutdown__Partitions_Taken_Over(t *testing.T) {
+	c := NewCluster(DefaultConfig(1))
+	c.Start()
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+
+	c.Shutdown(NodeName(0))
+	c.Run(time.Minute)
+
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, false, c.Node(NodeName(0)).Alive())
+	assert.Equal(t, []string{NodeName(2)}, c.Node(NodeName(1)).Members())
+}
+
+func TestCluster_Node_Shutdown__Drained_Before_Leaving(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.NodeCount = 4
+			conf.PartitionCount = 32
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+
+			leaving := c.Node(NodeName(2))
+			c.Shutdown(leaving.Name())
+
+			err := c.RunChecking(time.Minute, time.Millisecond, func() error {
+				if leaving.Alive() && len(leaving.Members()) < 3 {
+					return fmt.Errorf("node left before stopping its partitions")
+				}
+				return c.CheckNoDuplicate()
+			})
+			assert.Equal(t, nil, err)
+			assert.Equal(t, false, leaving.Alive())
+			assert.Equal(t, nil, c.CheckConverged())
+			assert.Equal(t, nil, c.CheckLookup())
+		})
+	}
+}
+
+func TestCluster_Late_Node_Join(t *testing.T) {
+	conf := DefaultConfig(3)
+	conf.NodeCount = 4
+
+	c := NewCluster(conf)
+	for i := 0; i < 3; i++ {
+		c.StartNode(NodeName(i))
+	}
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, 0, len(c.Node(NodeName(3)).Runner().Running()))
+
+	c.StartNode(NodeName(3))
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, 4, len(c.Node(NodeName(3)).Runner().Running()))
+}
+
+func TestCluster_Network_Split__Each_Side_Converged(t *testing.T) {
+	c := NewCluster(DefaultConfig(5))
+	c.Start()
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+
+	c.Network().Split([]string{NodeName(0)}, []string{NodeName(1), NodeName(2)})
+	c.Run(time.Minute)
+
+	assert.Equal(t, nil, c.CheckConverged(NodeName(0)))
+	assert.Equal(t, nil, c.CheckConverged(NodeName(1), NodeName(2)))
+}
+
+func TestCluster_Weighted_Nodes(t *testing.T) {
+	conf := DefaultConfig(11)
+	conf.PartitionCount = 20
+	conf.NodeOptions = func(name string) []shim.Option {
+		if name == NodeName(2) {
+			return []shim.Option{shim.WithNodeWeight(3)}
+		}
+		return nil
+	}
+
+	c := NewCluster(conf)
+	c.Start()
+	c.Run(time.Minute)
+
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, 4, len(c.Node(NodeName(0)).Runner().Running()))
+	assert.Equal(t, 4, len(c.Node(NodeName(1)).Runner().Running()))
+	assert.Equal(t, 12, len(c.Node(NodeName(2)).Runner().Running()))
+}
+
+func TestCluster_Rendezvous_Allocator(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.NodeCount = 4
+			conf.PartitionCount = 64
+			conf.DropRate = 0.2
+			conf.NodeOptions = func(name string) []shim.Option {
+				return []shim.Option{shim.WithAllocator(shim.NewRendezvousAllocator())}
+			}
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+
+			c.Crash(NodeName(3))
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+		})
+	}
+}
+
+func TestCluster_Zone_Aware_Allocator__Zone_Lost(t *testing.T) {
+	conf := DefaultConfig(13)
+	conf.NodeCount = 6
+	conf.PartitionCount = 36
+	conf.NodeOptions = func(name string) []shim.Option {
+		var zone string
+		switch name {
+		case NodeName(0), NodeName(1):
+			zone = "zone-1"
+		case NodeName(2), NodeName(3):
+			zone = "zone-2"
+		default:
+			zone = "zone-3"
+		}
+		return []shim.Option{
+			shim.WithNodeLabels(map[string]string{shim.LabelZone: zone}),
+			shim.WithAllocator(shim.NewZoneAwareAllocator(shim.LabelZone)),
+		}
+	}
+
+	c := NewCluster(conf)
+	c.Start()
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+
+	before := c.Running()
+	for _, n := range c.Nodes() {
+		assert.Equal(t, 6, len(n.Runner().Running()))
+	}
+
+	c.Crash(NodeName(4))
+	c.Crash(NodeName(5))
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+
+	moved := 0
+	for p, names := range c.Running() {
+		if before[p][0] != names[0] {
+			moved++
+		}
+	}
+	assert.Equal(t, 12, moved)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, 9, len(c.Node(NodeName(i)).Runner().Running()))
+	}
+}
+
+func TestCluster_Standbys__Promoted_On_Crash(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			conf := DefaultConfig(seed)
+			conf.NodeCount = 4
+			conf.PartitionCount = 32
+			conf.NodeOptions = func(name string) []shim.Option {
+				return []shim.Option{
+					shim.WithAllocator(shim.NewRendezvousAllocator()),
+					shim.WithStandbyCount(1),
+				}
+			}
+
+			c := NewCluster(conf)
+			c.Start()
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+
+			standbys := 0
+			for _, n := range c.Nodes() {
+				standbys += len(n.Runner().Standbys())
+			}
+			assert.Equal(t, 32, standbys)
+
+			crashed := len(c.Node(NodeName(3)).Runner().Running())
+			c.Crash(NodeName(3))
+			c.Run(time.Minute)
+			assert.Equal(t, nil, c.CheckConverged())
+
+			promoted := 0
+			for _, n := range c.Nodes() {
+				promoted += n.Runner().Promoted()
+			}
+			assert.Equal(t, crashed, promoted)
+		})
+	}
+}
+
+func TestCluster_Network_Split_Then_Heal__Rejoined(t *testing.T) {
+	c := NewCluster(DefaultConfig(17))
+	c.Start()
+	c.Run(time.Minute)
+	assert.Equal(t, nil, c.CheckConverged())
+
+	c.Network().Split([]string{NodeName(0)}, []string{NodeName(1), NodeName(2)})
+	c.Run(time.Minute)
+	assert.Equal(t, []string{}, c.Node(NodeName(0)).Members())
+
+	c.Network().Heal()
+	c.Run(time.Minute)
+
+	assert.Equal(t, []string{NodeName(1), NodeName(2)}, c.Node(NodeName(0)).Members())
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, nil, c.CheckNoDuplicate())
+}
+
+func TestCluster_Acked_Broadcasts__Converged_Without_Push_Pull(t *testing.T) {
+	conf := DefaultConfig(23)
+	conf.NodeCount = 4
+	conf.DropRate = 0.5
+	conf.PushPullInterval = 0
+	conf.NodeOptions = func(string) []shim.Option {
+		return []shim.Option{shim.WithAckedBroadcasts(200 * time.Millisecond)}
+	}
+
+	c := NewCluster(conf)
+	c.Start()
+	c.Run(30 * time.Second)
+
+	assert.Equal(t, nil, c.CheckConverged())
+	assert.Equal(t, nil, c.CheckLookup())
+	for _, n := range c.Nodes() {
+		assert.Greater(t, n.Service().Stats().Retransmits, uint64(0))
+	}
+}
@@ -0,0 +1,89 @@
+package shimtest
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Network is a fake network between simulated nodes, messages can be delayed, dropped,
+// reordered (by random delays) and blocked by network splits
+type Network struct {
+	clock *Clock
+	rand  *rand.Rand
+
+	minDelay time.Duration
+	maxDelay time.Duration
+	dropRate float64
+
+	groups map[string]int
+}
+
+func newNetwork(clock *Clock, r *rand.Rand, conf Config) *Network {
+	return &Network{
+		clock: clock,
+		rand:  r,
+
+		minDelay: conf.MinDelay,
+		maxDelay: conf.MaxDelay,
+		dropRate: conf.DropRate,
+	}
+}
+
+// SetDelay changes the range of random message delays
+func (n *Network) SetDelay(min time.Duration, max time.Duration) {
+	n.minDelay = min
+	n.maxDelay = max
+}
+
+// SetDropRate changes the probability of a message being lost
+func (n *Network) SetDropRate(rate float64) {
+	n.dropRate = rate
+}
+
+// Split divides the network into groups of nodes, nodes in different groups can not reach each other,
+// nodes not in any group form their own group
+func (n *Network) Split(groups ...[]string) {
+	n.groups = map[string]int{}
+	for i, group := range groups {
+		for _, name := range group {
+			n.groups[name] = i + 1
+		}
+	}
+}
+
+// Heal removes all network splits
+func (n *Network) Heal() {
+	n.groups = nil
+}
+
+// Reachable checks whether two nodes are in the same side of a split
+func (n *Network) Reachable(from string, to string) bool {
+	if n.groups == nil {
+		return true
+	}
+	return n.groups[from] == n.groups[to]
+}
+
+func (n *Network) randomDelay() time.Duration {
+	if n.maxDelay <= n.minDelay {
+		return n.minDelay
+	}
+	return n.minDelay + time.Duration(n.rand.Int63n(int64(n.maxDelay-n.minDelay)))
+}
+
+// send delivers a lossy message, reachability is checked both when sending and when receiving
+func (n *Network) send(from string, to string, deliver func()) {
+	if !n.Reachable(from, to) {
+		return
+	}
+	if n.dropRate > 0 && n.rand.Float64() < n.dropRate {
+		return
+	}
+
+	n.clock.AfterFunc(n.randomDelay(), func() {
+		if !n.Reachable(from, to) {
+			return
+		}
+		deliver()
+	})
+}
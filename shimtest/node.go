@@ -0,0 +1,233 @@
+package shimtest
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/QuangTung97/shim"
+)
+
+// Node is a simulated node, it plays the role of the membership layer of its Service
+type Node struct {
+	cluster *Cluster
+
+	name string
+	addr string
+
+	service *shim.Service
+	runner  *Runner
+
+	alive bool
+	// incarnation is increased every time the node crashes, so that pending events of the old process are ignored
+	incarnation int
+	members     map[string]struct{}
+}
+
+var _ shim.NodeDelegate = &Node{}
+
+var errNoReachableNode = errors.New("shimtest: no reachable node")
+
+// Name ...
+func (n *Node) Name() string {
+	return n.name
+}
+
+// Addr ...
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Service ...
+func (n *Node) Service() *shim.Service {
+	return n.service
+}
+
+// Runner ...
+func (n *Node) Runner() *Runner {
+	return n.runner
+}
+
+// Alive ...
+func (n *Node) Alive() bool {
+	return n.alive
+}
+
+// Members returns the sorted names of other nodes this node currently sees as members
+func (n *Node) Members() []string {
+	result := make([]string, 0, len(n.members))
+	for name := range n.members {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (n *Node) reachable(other *Node) bool {
+	return other.alive && n.cluster.network.Reachable(n.name, other.name)
+}
+
+func (n *Node) addMember(other *Node) {
+	if other == n {
+		return
+	}
+	if _, existed := n.members[other.name]; existed {
+		return
+	}
+	n.members[other.name] = struct{}{}
+	n.service.NotifyJoin(other.name, other.addr, other.service.NodeMeta())
+}
+
+func (n *Node) removeMember(name string) {
+	if _, existed := n.members[name]; !existed {
+		return
+	}
+	delete(n.members, name)
+	n.service.NotifyLeave(name)
+}
+
+// pushPull exchanges membership and partition state with another node, like a TCP push/pull
+func (n *Node) pushPull(other *Node) {
+	for _, name := range other.Members() {
+		member := n.cluster.nodes[name]
+		if n.reachable(member) {
+			n.addMember(member)
+		}
+	}
+	for _, name := range n.Members() {
+		member := n.cluster.nodes[name]
+		if other.reachable(member) {
+			other.addMember(member)
+		}
+	}
+	n.addMember(other)
+	other.addMember(n)
+
+	other.service.MergeRemoteState(n.service.LocalState())
+	n.service.MergeRemoteState(other.service.LocalState())
+}
+
+// Join implements shim.NodeDelegate
+func (n *Node) Join(addrs []string) error {
+	if !n.alive {
+		return errNoReachableNode
+	}
+
+	joined := false
+	for _, addr := range addrs {
+		other, ok := n.cluster.addrs[addr]
+		if !ok || !n.reachable(other) {
+			continue
+		}
+		n.pushPull(other)
+		joined = true
+	}
+	if !joined {
+		return errNoReachableNode
+	}
+	return nil
+}
+
+// Leave implements shim.NodeDelegate
+func (n *Node) Leave() {
+	if !n.alive {
+		return
+	}
+	for _, name := range n.Members() {
+		member := n.cluster.nodes[name]
+		n.cluster.network.send(n.name, name, func() {
+			member.removeMember(n.name)
+		})
+	}
+	n.stop()
+}
+
+// process is the shim.NodeDelegate of the Service of a single run of a node,
+// the calls of a Service replaced by a restart are ignored
+type process struct {
+	node        *Node
+	incarnation int
+}
+
+var _ shim.NodeDelegate = process{}
+
+func (p process) replaced() bool {
+	return p.node.incarnation != p.incarnation
+}
+
+// Join implements shim.NodeDelegate
+func (p process) Join(addrs []string) error {
+	if p.replaced() {
+		return errNoReachableNode
+	}
+	return p.node.Join(addrs)
+}
+
+// Leave implements shim.NodeDelegate
+func (p process) Leave() {
+	if p.replaced() {
+		return
+	}
+	p.node.Leave()
+}
+
+// Broadcast implements shim.NodeDelegate
+func (p process) Broadcast(msg []byte) {
+	if p.replaced() {
+		return
+	}
+	p.node.Broadcast(msg)
+}
+
+// Broadcast implements shim.NodeDelegate
+func (n *Node) Broadcast(msg []byte) {
+	if !n.alive {
+		return
+	}
+	for _, name := range n.Members() {
+		member := n.cluster.nodes[name]
+		data := append([]byte(nil), msg...)
+		n.cluster.network.send(n.name, name, func() {
+			if !member.alive {
+				return
+			}
+			member.service.NotifyMsg(data)
+		})
+	}
+}
+
+func (n *Node) stop() {
+	n.alive = false
+	n.incarnation++
+	n.members = map[string]struct{}{}
+	n.runner.reset()
+}
+
+// probe removes the members that can not be reached anymore, like the failure detector of memberlist
+func (n *Node) probe() {
+	if !n.alive {
+		return
+	}
+	for _, name := range n.Members() {
+		if !n.reachable(n.cluster.nodes[name]) {
+			n.removeMember(name)
+		}
+	}
+}
+
+func (n *Node) periodicPushPull() {
+	if !n.alive {
+		return
+	}
+
+	var candidates []*Node
+	for _, name := range n.Members() {
+		member := n.cluster.nodes[name]
+		if n.reachable(member) {
+			candidates = append(candidates, member)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	n.pushPull(candidates[n.cluster.rand.Intn(len(candidates))])
+}
@@ -0,0 +1,130 @@
+package shimtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/QuangTung97/shim"
+)
+
+// Runner is a fake partition runner, starting and stopping take a random amount of virtual time.
+// It also keeps standbys, which are only used when the nodes are configured with shim.WithStandbyCount
+type Runner struct {
+	node *Node
+	// incarnation is the run of the node this runner belongs to, a restarted node gets a new runner
+	incarnation int
+
+	running  map[shim.PartitionID]struct{}
+	standbys map[shim.PartitionID]struct{}
+	promoted int
+}
+
+var _ shim.ReplicaRunner = &Runner{}
+
+func newRunner(node *Node) *Runner {
+	return &Runner{
+		node:        node,
+		incarnation: node.incarnation,
+
+		running:  map[shim.PartitionID]struct{}{},
+		standbys: map[shim.PartitionID]struct{}{},
+	}
+}
+
+func (r *Runner) reset() {
+	r.running = map[shim.PartitionID]struct{}{}
+	r.standbys = map[shim.PartitionID]struct{}{}
+}
+
+func (r *Runner) after(action func()) {
+	if r.node.incarnation != r.incarnation {
+		return
+	}
+	r.node.cluster.clock.AfterFunc(r.randomDelay(), func() {
+		if !r.node.alive || r.node.incarnation != r.incarnation {
+			return
+		}
+		action()
+	})
+}
+
+func (r *Runner) randomDelay() time.Duration {
+	maxDelay := r.node.cluster.conf.RunnerDelay
+	if maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(r.node.cluster.rand.Int63n(int64(maxDelay)))
+}
+
+// Start implements shim.PartitionRunner
+func (r *Runner) Start(partition shim.PartitionID, _ shim.Epoch, startCompleted func()) {
+	r.after(func() {
+		r.running[partition] = struct{}{}
+		startCompleted()
+	})
+}
+
+// Stop implements shim.PartitionRunner
+func (r *Runner) Stop(partition shim.PartitionID, stopCompleted func()) {
+	r.after(func() {
+		delete(r.running, partition)
+		stopCompleted()
+	})
+}
+
+// StartStandby implements shim.ReplicaRunner
+func (r *Runner) StartStandby(partition shim.PartitionID, startCompleted func()) {
+	r.after(func() {
+		r.standbys[partition] = struct{}{}
+		startCompleted()
+	})
+}
+
+// StopStandby implements shim.ReplicaRunner
+func (r *Runner) StopStandby(partition shim.PartitionID, stopCompleted func()) {
+	r.after(func() {
+		delete(r.standbys, partition)
+		stopCompleted()
+	})
+}
+
+// Promote implements shim.ReplicaRunner, the standby of the partition becomes running
+func (r *Runner) Promote(partition shim.PartitionID, _ shim.Epoch, promoteCompleted func()) {
+	r.after(func() {
+		if _, existed := r.standbys[partition]; existed {
+			r.promoted++
+		}
+		delete(r.standbys, partition)
+		r.running[partition] = struct{}{}
+		promoteCompleted()
+	})
+}
+
+// Promoted returns the number of partitions started by promoting a standby
+func (r *Runner) Promoted() int {
+	return r.promoted
+}
+
+// Running returns the sorted list of running partitions
+func (r *Runner) Running() []shim.PartitionID {
+	result := make([]shim.PartitionID, 0, len(r.running))
+	for p := range r.running {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// Standbys returns the sorted list of partitions having a standby on the node
+func (r *Runner) Standbys() []shim.PartitionID {
+	result := make([]shim.PartitionID, 0, len(r.standbys))
+	for p := range r.standbys {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
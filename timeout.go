@@ -0,0 +1,234 @@
+package shim
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Operation is an operation of a runner on a partition
+type Operation int
+
+const (
+	// OperationStart is the start (or the promotion) of a partition
+	OperationStart Operation = iota + 1
+	// OperationStop is the stop of a partition
+	OperationStop
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OperationStart:
+		return "start"
+	case OperationStop:
+		return "stop"
+	default:
+		return fmt.Sprintf("operation(%d)", int(op))
+	}
+}
+
+// StuckPolicy decides what to do when a runner does not complete an operation before its deadline
+type StuckPolicy int
+
+const (
+	// StuckPolicyRetry considers the operation failed and retries it with backoff, the default policy
+	StuckPolicyRetry StuckPolicy = iota
+	// StuckPolicyForceRelease considers a stuck stop completed and broadcasts that the partition is left,
+	// so another node can take it over even though the runner may still be running it.
+	// A stuck start is retried as with StuckPolicyRetry
+	StuckPolicyForceRelease
+	// StuckPolicyCrash calls the crash handler, by default it panics
+	StuckPolicyCrash
+)
+
+// Stats is a snapshot of the counters of a service
+type Stats struct {
+	StuckStarts uint64
+	StuckStops  uint64
+
+	// Handoffs counts the partitions started after waiting for their previous holders to release them,
+	// ForcedHandoffs the ones taken over after the handoff timeout, HandoffWait is the total time waited
+	Handoffs       uint64
+	ForcedHandoffs uint64
+	HandoffWait    time.Duration
+
+	// PendingMigrations is the number of partitions currently waiting for a migration slot
+	PendingMigrations int
+
+	// UnhealthyReleases counts the partitions released by this node because they were reported unhealthy
+	UnhealthyReleases uint64
+
+	// Retransmits counts the partition broadcasts sent again because they were not acknowledged in time,
+	// BroadcastOverflows the ones given up because the window of unacknowledged broadcasts was full
+	Retransmits        uint64
+	BroadcastOverflows uint64
+}
+
+// beginOperation invalidates the completion of the previous operation on the partition
+// and arms the deadline of the new one
+func (s *coreService) beginOperation(id PartitionID, op Operation) uint64 {
+	s.opSeqs[id]++
+	seq := s.opSeqs[id]
+
+	if timer := s.opTimers[id]; timer != nil {
+		timer.Stop()
+		s.opTimers[id] = nil
+	}
+
+	timeout := s.options.startTimeout
+	if op == OperationStop {
+		timeout = s.options.stopTimeout
+	}
+	if timeout > 0 {
+		s.opTimers[id] = s.options.clock.NewTimer(timeout, func() {
+			s.operationTimeout(id, op, seq)
+		})
+	}
+	return seq
+}
+
+// endOperation returns false when the completion belongs to an operation that is not the current one anymore
+func (s *coreService) endOperation(id PartitionID, seq uint64) bool {
+	if s.opSeqs[id] != seq {
+		return false
+	}
+	s.opSeqs[id]++
+
+	if timer := s.opTimers[id]; timer != nil {
+		timer.Stop()
+		s.opTimers[id] = nil
+	}
+	return true
+}
+
+func (s *coreService) operationTimeout(id PartitionID, op Operation, seq uint64) {
+	s.lock()
+	defer s.unlock()
+
+	if s.opSeqs[id] != seq {
+		return
+	}
+
+	if op == OperationStart {
+		s.stats.StuckStarts++
+	} else {
+		s.stats.StuckStops++
+	}
+
+	if s.options.stuckPolicy == StuckPolicyCrash {
+		handler := s.options.crashHandler
+		s.addPending(func() {
+			handler(id, op)
+		})
+		return
+	}
+
+	s.endOperation(id, seq)
+	if cancel := s.cancels[id]; cancel != nil {
+		cancel()
+		s.cancels[id] = nil
+	}
+	if op == OperationStart {
+		s.abandonStart(id, seq)
+	}
+
+	prevHolder := s.partitions[id].state.holder()
+	s.observe(id, func(p *partition) {
+		switch {
+		case op == OperationStart:
+			p.startTimedOut()
+		case s.options.stuckPolicy == StuckPolicyForceRelease:
+			p.completeStopping()
+		default:
+			p.stopFailed()
+		}
+	})
+	s.updateStandby(id)
+	s.migrationReleased(id, prevHolder)
+}
+
+// abandonedStart is a start considered failed after its deadline, the runner may still complete it later
+type abandonedStart struct {
+	seq         uint64
+	incarnation uint64
+}
+
+// maxAbandonedStarts is the number of abandoned starts tracked per partition
+const maxAbandonedStarts = 4
+
+// abandonStart tracks the start until it completes, only the newest ones are kept
+// for a runner that never completes them. The completion of an older one is ignored,
+// the run is then fenced by the newer incarnations
+func (s *coreService) abandonStart(id PartitionID, seq uint64) {
+	list := s.abandoned[id]
+	if len(list) >= maxAbandonedStarts {
+		list = append(list[:0:0], list[len(list)-maxAbandonedStarts+1:]...)
+	}
+	s.abandoned[id] = append(list, abandonedStart{
+		seq:         seq,
+		incarnation: s.partitions[id].startingIncarnation,
+	})
+}
+
+// abandonedStartCompleted handles the late completion of an abandoned start. The runner is then running the partition,
+// it is adopted when no other start was issued meanwhile, otherwise it is stopped so that it does not run twice
+func (s *coreService) abandonedStartCompleted(id PartitionID, seq uint64, err error) {
+	list := s.abandoned[id]
+	index := -1
+	for i, a := range list {
+		if a.seq == seq {
+			index = i
+		}
+	}
+	if index < 0 {
+		return
+	}
+	a := list[index]
+	s.abandoned[id] = append(list[:index:index], list[index+1:]...)
+
+	if err != nil {
+		return
+	}
+
+	adopted := false
+	s.observe(id, func(p *partition) {
+		adopted = p.adoptStart(a.incarnation)
+	})
+	if adopted {
+		if timer := s.retryTimers[id]; timer != nil {
+			timer.Stop()
+			s.retryTimers[id] = nil
+		}
+		s.updateStandby(id)
+		return
+	}
+
+	s.abandonedStops++
+	info := PartitionInfo{
+		ID:    id,
+		Epoch: Epoch{Incarnation: a.incarnation, Node: s.selfNode},
+	}
+	s.addPending(func() {
+		s.runner.stop(context.Background(), info, func(error) {
+			s.abandonedStopCompleted()
+		})
+	})
+}
+
+func (s *coreService) abandonedStopCompleted() {
+	s.lock()
+	defer s.unlock()
+
+	s.abandonedStops--
+}
+
+func (s *coreService) getStats() Stats {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.stats
+}
+
+func defaultCrashHandler(partition PartitionID, op Operation) {
+	panic(fmt.Sprintf("shim: %v of partition %d is stuck", op, partition))
+}
@@ -0,0 +1,238 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type timeoutTest struct {
+	core   *coreService
+	clock  *fakeClock
+	runner *PartitionRunnerMock
+
+	broadcaster    *noopPartitionBroadcaster
+	startCompleted []func()
+	stopCompleted  []func()
+}
+
+func newTimeoutTest(opts ...Option) *timeoutTest {
+	c := &timeoutTest{
+		clock:       newFakeClock(),
+		runner:      &PartitionRunnerMock{},
+		broadcaster: &noopPartitionBroadcaster{msgs: map[PartitionID]partitionMsg{}},
+	}
+	c.runner.StartFunc = func(partition PartitionID, _ Epoch, startCompleted func()) {
+		c.startCompleted = append(c.startCompleted, startCompleted)
+	}
+	c.runner.StopFunc = func(partition PartitionID, stopCompleted func()) {
+		c.stopCompleted = append(c.stopCompleted, stopCompleted)
+	}
+
+	opts = append([]Option{
+		WithClock(c.clock),
+		WithOperationTimeouts(time.Second, 2*time.Second),
+	}, opts...)
+	c.core = newCoreService(1, "node01", "address01", newCallbackRunner(c.runner), c.broadcaster, nil, computeOptions(opts...))
+	return c
+}
+
+func (c *timeoutTest) startRunning() {
+	c.core.onJoinCompleted()
+	c.startCompleted[0]()
+	c.core.onChange([]nodeInfo{
+		{name: "node00", addr: "address00"},
+		{name: "node01", addr: "address01"},
+	})
+}
+
+func TestOperation_String(t *testing.T) {
+	assert.Equal(t, "start", OperationStart.String())
+	assert.Equal(t, "stop", OperationStop.String())
+	assert.Equal(t, "operation(3)", Operation(3).String())
+}
+
+func TestCoreService_Start_Stuck__Retry(t *testing.T) {
+	c := newTimeoutTest()
+
+	c.core.onJoinCompleted()
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+
+	c.clock.advance(999 * time.Millisecond)
+	assert.Equal(t, Stats{}, c.core.getStats())
+
+	c.clock.advance(time.Millisecond)
+	assert.Equal(t, Stats{StuckStarts: 1}, c.core.getStats())
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+
+	c.clock.advance(100 * time.Millisecond)
+	assert.Equal(t, 2, len(c.runner.StartCalls()))
+	assert.Equal(t, partitionStatusStarting, c.core.partitions[0].state.status)
+
+	// the stuck start completes while the retry is in flight, it is stopped
+	c.startCompleted[0]()
+	assert.Equal(t, partitionStatusStarting, c.core.partitions[0].state.status)
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+
+	c.startCompleted[1]()
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[0].state.status)
+	assert.Equal(t, partitionMsg{incarnation: 2, current: "node01"}, c.broadcaster.msgs[0])
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, Stats{StuckStarts: 1}, c.core.getStats())
+}
+
+func TestCoreService_Start_Stuck__Completed_Before_Retry__Adopted(t *testing.T) {
+	c := newTimeoutTest()
+
+	c.core.onJoinCompleted()
+	c.clock.advance(time.Second)
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+
+	c.startCompleted[0]()
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[0].state.status)
+	assert.Equal(t, partitionMsg{incarnation: 1, current: "node01"}, c.broadcaster.msgs[0])
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+	assert.Equal(t, 0, len(c.runner.StopCalls()))
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[0].state.status)
+}
+
+func TestCoreService_Start_Stuck__Reallocated__Stopped_When_Completed(t *testing.T) {
+	c := newTimeoutTest()
+
+	c.core.onJoinCompleted()
+	c.clock.advance(time.Second)
+
+	c.core.onChange([]nodeInfo{
+		{name: "node00", addr: "address00"},
+		{name: "node01", addr: "address01"},
+	})
+	assert.Equal(t, "node00", c.core.partitions[0].state.owner)
+
+	c.startCompleted[0]()
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+	assert.Equal(t, 0, len(c.broadcaster.msgs))
+
+	drained := false
+	c.core.shutdown(func() {
+		drained = true
+	})
+	assert.Equal(t, false, drained)
+
+	c.stopCompleted[0]()
+	assert.Equal(t, true, drained)
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+}
+
+func TestCoreService_Stop_Stuck__Retry_Stop(t *testing.T) {
+	c := newTimeoutTest()
+	c.startRunning()
+
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+
+	c.clock.advance(2 * time.Second)
+	assert.Equal(t, Stats{StuckStops: 1}, c.core.getStats())
+	assert.Equal(t, partitionStatusRunning, c.core.partitions[0].state.status)
+
+	c.clock.advance(100 * time.Millisecond)
+	assert.Equal(t, 2, len(c.runner.StopCalls()))
+
+	c.stopCompleted[1]()
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+	assert.Equal(t, true, c.core.partitions[0].state.left)
+}
+
+func TestCoreService_Stop_Stuck__Force_Release(t *testing.T) {
+	c := newTimeoutTest(WithStuckPolicy(StuckPolicyForceRelease))
+	c.startRunning()
+
+	c.clock.advance(2 * time.Second)
+
+	assert.Equal(t, Stats{StuckStops: 1}, c.core.getStats())
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+	assert.Equal(t, partitionMsg{
+		incarnation: 1,
+		current:     "node01",
+		left:        true,
+	}, c.broadcaster.msgs[0])
+}
+
+func TestCoreService_Stop_Stuck__Crash(t *testing.T) {
+	var stuck []Operation
+	c := newTimeoutTest(
+		WithStuckPolicy(StuckPolicyCrash),
+		WithCrashHandler(func(partition PartitionID, op Operation) {
+			stuck = append(stuck, op)
+		}),
+	)
+	c.startRunning()
+
+	c.clock.advance(2 * time.Second)
+
+	assert.Equal(t, []Operation{OperationStop}, stuck)
+	assert.Equal(t, Stats{StuckStops: 1}, c.core.getStats())
+	assert.Equal(t, partitionStatusStopping, c.core.partitions[0].state.status)
+}
+
+func TestDefaultCrashHandler__Panic(t *testing.T) {
+	assert.PanicsWithValue(t, "shim: start of partition 3 is stuck", func() {
+		defaultCrashHandler(3, OperationStart)
+	})
+}
+
+func TestCoreService_Stop_Failed__Shutdown__Retried_At_Once(t *testing.T) {
+	c := newTimeoutTest()
+	c.startRunning()
+
+	c.clock.advance(2 * time.Second)
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+
+	drained := false
+	c.core.shutdown(func() {
+		drained = true
+	})
+	assert.Equal(t, 2, len(c.runner.StopCalls()))
+
+	c.stopCompleted[1]()
+	assert.Equal(t, true, drained)
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, 2, len(c.runner.StopCalls()))
+}
+
+func TestCoreService_Start_Failed__Closed__Not_Retried(t *testing.T) {
+	c := newTimeoutTest()
+
+	c.core.onJoinCompleted()
+	c.clock.advance(time.Second)
+	assert.Equal(t, partitionStatusStopped, c.core.partitions[0].state.status)
+
+	c.core.close()
+
+	c.clock.advance(time.Hour)
+	assert.Equal(t, 1, len(c.runner.StartCalls()))
+}
+
+func TestCoreService_Start_Stuck_Repeatedly__Abandoned_Starts_Bounded(t *testing.T) {
+	c := newTimeoutTest(WithRetryBackoff(time.Millisecond, time.Millisecond))
+
+	c.core.onJoinCompleted()
+	for i := 0; i < 10; i++ {
+		c.clock.advance(time.Second + time.Millisecond)
+	}
+	assert.Equal(t, 11, len(c.runner.StartCalls()))
+	assert.Equal(t, maxAbandonedStarts, len(c.core.abandoned[0]))
+	assert.Equal(t, uint64(10), c.core.abandoned[0][maxAbandonedStarts-1].incarnation)
+
+	// the oldest start is no longer tracked, its completion is ignored
+	c.startCompleted[0]()
+	assert.Equal(t, 0, len(c.runner.StopCalls()))
+
+	c.startCompleted[9]()
+	assert.Equal(t, 1, len(c.runner.StopCalls()))
+	assert.Equal(t, maxAbandonedStarts-1, len(c.core.abandoned[0]))
+}
@@ -21,3 +21,14 @@ func (t *simpleTimer) Reset() {
 func (t *simpleTimer) Stop() {
 	t.timer.Stop()
 }
+
+type systemClock struct {
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration, callback func()) Timer {
+	return newTimer(d, callback)
+}
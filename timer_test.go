@@ -0,0 +1,109 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+type fakeTimer struct {
+	clock    *fakeClock
+	d        time.Duration
+	callback func()
+	expire   time.Time
+	active   bool
+}
+
+// fakeClock only fires timers when advance is called
+type fakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ Clock = &fakeClock{}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: mustParse("2021-05-10T10:00:00+07:00")}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration, callback func()) Timer {
+	t := &fakeTimer{clock: c, d: d, callback: callback}
+	c.timers = append(c.timers, t)
+	t.Reset()
+	return t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	end := c.now.Add(d)
+	for {
+		var active []*fakeTimer
+		for _, t := range c.timers {
+			if t.active && !t.expire.After(end) {
+				active = append(active, t)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+		sort.SliceStable(active, func(i, j int) bool {
+			return active[i].expire.Before(active[j].expire)
+		})
+
+		t := active[0]
+		c.now = t.expire
+		t.active = false
+		t.callback()
+	}
+	c.now = end
+}
+
+func (t *fakeTimer) Reset() {
+	t.active = true
+	t.expire = t.clock.now.Add(t.d)
+}
+
+func (t *fakeTimer) Stop() {
+	t.active = false
+}
+
+func TestSimpleTimer(t *testing.T) {
+	ch := make(chan struct{}, 2)
+	timer := newTimer(10*time.Millisecond, func() {
+		ch <- struct{}{}
+	})
+	<-ch
+
+	timer.Reset()
+	<-ch
+
+	timer.Reset()
+	timer.Stop()
+
+	select {
+	case <-ch:
+		t.Fatal("timer must be stopped")
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+
+	var calls []time.Duration
+	c.NewTimer(20*time.Second, func() { calls = append(calls, c.Now().Sub(start)) })
+	timer := c.NewTimer(10*time.Second, func() { calls = append(calls, c.Now().Sub(start)) })
+
+	c.advance(15 * time.Second)
+	assert.Equal(t, []time.Duration{10 * time.Second}, calls)
+
+	timer.Reset()
+	c.advance(15 * time.Second)
+	assert.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second}, calls)
+	assert.Equal(t, start.Add(30*time.Second), c.Now())
+}